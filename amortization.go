@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rickar/cal/v2"
+)
+
+// Bases in which prices are quoted.
+const (
+	QuoteOriginalFace = "original" // per 100 of original face value (default, as the cashflows in bonds.json)
+	QuoteCurrentFace  = "current"  // per 100 of the current face value: original face less amortizations plus capitalized interest
+)
+
+// faceState is the outstanding face value of a bond on a date, per 100 of original face value, for a holder settling that day.
+// Payments whose record date is not before the date are still due to the holder, so they are not deducted yet.
+type faceState struct {
+	lastPayment time.Time // last payment the holder is not entitled to, or the issue date
+	lastAmort   float64   // amortization paid on lastPayment
+	next        *Flujo    // next payment due to the holder, nil after maturity
+	residual    float64   // current face value: after the last payment, including capitalized interest
+	factor      float64   // pool factor: residual / 100
+	rate        float64   // coupon rate accruing: the one of the next payment, or of the ex payment in the ex-coupon period
+	accrualBase float64   // face value the interest accrues on
+	accDays     int       // days accrued since lastPayment, negative in the ex-coupon period
+	ex          bool      // the date is between the record date and the payment date of lastPayment
+}
+
+// faceStateAt walks the cashflow (in date order) up to date. Residual is taken from the
+// last payment made, so amortizations and capitalizations of irregular schedules are followed exactly.
+// A payment counts as made once its record date (recordDays business days of c before it, see recordDate) is
+// before date: in the ex-coupon period the seller keeps the payment and the buyer's accrued interest is negative.
+func faceStateAt(flow []Flujo, issueDate time.Time, date time.Time, recordDays int, c *cal.BusinessCalendar) faceState {
+	sorted := make([]Flujo, len(flow))
+	copy(sorted, flow)
+	sort.SliceStable(sorted, func(i, j int) bool { return time.Time(sorted[i].Date).Before(time.Time(sorted[j].Date)) })
+
+	s := faceState{lastPayment: issueDate, residual: 100}
+	for i := range sorted {
+		cf := sorted[i]
+		payment := time.Time(cf.Date)
+		if !recordDate(payment, recordDays, c).Before(date) {
+			s.next = &sorted[i]
+			break
+		}
+		s.ex = !payment.Before(date)
+		if s.ex {
+			s.rate, s.accrualBase = cf.Rate, s.residual
+		}
+		s.lastPayment = payment
+		s.lastAmort = cf.Amort
+		s.residual = cf.Residual
+	}
+	s.factor = s.residual / 100
+	if !s.ex {
+		s.accrualBase = s.residual
+		if s.next != nil {
+			s.rate = s.next.Rate
+		}
+	}
+	if date.After(s.lastPayment) || s.ex {
+		s.accDays = int(math.Round(date.Sub(s.lastPayment).Hours() / 24))
+	}
+	return s
+}
+
+// accrued is the interest accrued since the last payment per 100 of original face value (days/360).
+// It is negative in the ex-coupon period: the buyer pays less since the coupon goes to the seller.
+func (s faceState) accrued() float64 {
+	return float64(s.accDays) / 360 * s.rate * s.accrualBase
+}
+
+// normalizeQuote maps the quote param to QuoteOriginalFace (default) or QuoteCurrentFace.
+func normalizeQuote(quote string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(quote)) {
+	case "", QuoteOriginalFace:
+		return QuoteOriginalFace, nil
+	case QuoteCurrentFace:
+		return QuoteCurrentFace, nil
+	}
+	return "", fmt.Errorf("unknown quote %q, use original or current", quote)
+}
+
+// toOriginalFace converts a price quoted in quote to a price per 100 of original face value.
+func toOriginalFace(price float64, quote string, s faceState) float64 {
+	if quote == QuoteCurrentFace {
+		return price * s.factor
+	}
+	return price
+}
+
+// fromOriginalFace converts a price per 100 of original face value to quote. A bond fully repaid has no current face.
+func fromOriginalFace(price float64, quote string, s faceState) float64 {
+	if quote == QuoteCurrentFace && s.factor != 0 {
+		return price / s.factor
+	}
+	return price
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// amortizingFlow pays half the face value on each of two dates, with a 5% coupon. It is out of order on purpose.
+var amortizingFlow = []Flujo{
+	{Date: Fecha(mustDate("2025-01-01")), Rate: 0.05, Amort: 50, Residual: 0, Amount: 51.25},
+	{Date: Fecha(mustDate("2024-07-01")), Rate: 0.05, Amort: 50, Residual: 50, Amount: 52.5},
+}
+
+func TestFaceStateAt(t *testing.T) {
+	issue := mustDate("2024-01-01")
+	tests := []struct {
+		name        string
+		date        string
+		lastPayment string
+		next        string // "" after maturity
+		residual    float64
+		rate        float64
+		accDays     int
+	}{
+		{"issue date", "2024-01-01", "2024-01-01", "2024-07-01", 100, 0.05, 0},
+		{"before the first payment", "2024-04-01", "2024-01-01", "2024-07-01", 100, 0.05, 91},
+		{"payment date is still due", "2024-07-01", "2024-01-01", "2024-07-01", 100, 0.05, 182},
+		{"after the first payment", "2024-07-02", "2024-07-01", "2025-01-01", 50, 0.05, 1},
+		{"after maturity", "2025-02-01", "2025-01-01", "", 0, 0, 31},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := faceStateAt(amortizingFlow, issue, mustDate(tt.date), 0, nil)
+			if got := s.lastPayment.Format(DateFormat); got != tt.lastPayment {
+				t.Errorf("lastPayment %s, want %s", got, tt.lastPayment)
+			}
+			if tt.next == "" && s.next != nil {
+				t.Errorf("next %s, want none", s.next.Date.Format(DateFormat))
+			} else if tt.next != "" && (s.next == nil || s.next.Date.Format(DateFormat) != tt.next) {
+				t.Errorf("next %v, want %s", s.next, tt.next)
+			}
+			if s.residual != tt.residual || s.factor != tt.residual/100 {
+				t.Errorf("residual %v factor %v, want %v", s.residual, s.factor, tt.residual)
+			}
+			if s.rate != tt.rate || s.accDays != tt.accDays || s.ex {
+				t.Errorf("rate %v accDays %d ex %v, want %v %d false", s.rate, s.accDays, s.ex, tt.rate, tt.accDays)
+			}
+			want := float64(tt.accDays) / 360 * tt.rate * tt.residual
+			if math.Abs(s.accrued()-want) > 1e-12 {
+				t.Errorf("accrued %v, want %v", s.accrued(), want)
+			}
+		})
+	}
+}
+
+func TestQuoteConversions(t *testing.T) {
+	tests := []struct {
+		name     string
+		quote    string
+		factor   float64
+		original float64
+		quoted   float64
+	}{
+		{"original face", QuoteOriginalFace, 0.5, 40, 40},
+		{"current face", QuoteCurrentFace, 0.5, 40, 80},
+		{"current face of a repaid bond", QuoteCurrentFace, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := faceState{factor: tt.factor}
+			if got := fromOriginalFace(tt.original, tt.quote, s); got != tt.quoted {
+				t.Errorf("fromOriginalFace = %v, want %v", got, tt.quoted)
+			}
+			if got := toOriginalFace(tt.quoted, tt.quote, s); got != tt.original {
+				t.Errorf("toOriginalFace = %v, want %v", got, tt.original)
+			}
+		})
+	}
+}
+
+func TestNormalizeQuote(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"", QuoteOriginalFace, false},
+		{" Original ", QuoteOriginalFace, false},
+		{"CURRENT", QuoteCurrentFace, false},
+		{"residual", "", true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeQuote(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("normalizeQuote(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
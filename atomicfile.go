@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// writeFileAtomic writes data to a temp file in the same directory, syncs it and renames it over path.
+// A crash at any point leaves either the old or the new content in path, never a partial file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	tmpName := tmp.Name()
+	// si algo falla antes del rename no dejamos el temporal tirado
+	defer os.Remove(tmpName)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write temp file: %w", err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return fmt.Errorf("chmod temp file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close temp file: %w", err)
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return fmt.Errorf("rename temp file: %w", err)
+	}
+	return syncDir(dir)
+}
+
+// syncDir flushes the directory entry so the rename survives a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("open dir: %w", err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("sync dir: %w", err)
+	}
+	return nil
+}
+
+// layout of the timestamp in backup names. Sorts chronologically as a string.
+const backupStamp = "20060102T150405.000000000"
+
+// backupFile copies path to a timestamped file next to it and keeps only the newest keep backups.
+// Backups are named <name>_<timestamp>.json so they sort chronologically.
+func backupFile(path string, keep int) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil // nada que respaldar
+	} else if err != nil {
+		return fmt.Errorf("read %s: %w", path, err)
+	}
+
+	ext := filepath.Ext(path)
+	prefix := strings.TrimSuffix(path, ext) + "_"
+	dest := prefix + time.Now().UTC().Format(backupStamp) + ext
+	if err := writeFileAtomic(dest, data, 0644); err != nil {
+		return fmt.Errorf("backup %s: %w", path, err)
+	}
+	return pruneBackups(prefix, ext, keep)
+}
+
+func pruneBackups(prefix string, ext string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	all, err := filepath.Glob(prefix + "*" + ext)
+	if err != nil {
+		return err
+	}
+	// solo cuentan los backups con timestamp (o los diarios viejos), no cualquier archivo con el mismo prefijo
+	var matches []string
+	for _, m := range all {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(m, prefix), ext)
+		if _, err := time.Parse(backupStamp, stamp); err == nil {
+			matches = append(matches, m)
+		} else if _, err := time.Parse(DateFormat, stamp); err == nil {
+			matches = append(matches, m)
+		}
+	}
+	sort.Strings(matches)
+	for len(matches) > keep {
+		if err := os.Remove(matches[0]); err != nil {
+			return fmt.Errorf("remove old backup: %w", err)
+		}
+		matches = matches[1:]
+	}
+	return nil
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BondsFile is the path of the json holding the bonds when the file store is used.
+const BondsFile = "./bonds.json"
+
+// errNoVersioning is returned by stores that do not keep the history of the bonds.
+var errNoVersioning = errors.New("bond versioning requires the postgres store (BONDS_STORE=postgres)")
+
+// BondVersion is one stored revision of a bond, with who changed it, when and why.
+type BondVersion struct {
+	Version   int
+	Ticker    string
+	Author    string
+	Reason    string
+	CreatedAt time.Time
+	Bond      Bond
+}
+
+// BondStore persists the bonds served by the API.
+// Load returns the latest version of every bond. Save stores a new version of a bond and returns its number.
+// History and LoadAsOf are only available on stores that keep versions.
+type BondStore interface {
+	Load(ctx context.Context) ([]Bond, error)
+	Save(ctx context.Context, bond Bond, author string, reason string) (int, error)
+	History(ctx context.Context, ticker string) ([]BondVersion, error)
+	LoadAsOf(ctx context.Context, version int) ([]Bond, error)
+}
+
+// Store used by the endpoints. It is chosen on startup by newBondStore.
+var bondStore BondStore
+
+// Elige el store según BONDS_STORE: "postgres" o "file" (default).
+func newBondStore() BondStore {
+	switch strings.ToLower(os.Getenv("BONDS_STORE")) {
+	case "postgres":
+		return newPgBondStore(BondsFile)
+	default:
+		keep := defaultBondBackups
+		if n, err := strconv.Atoi(os.Getenv("BONDS_BACKUPS")); err == nil {
+			keep = n
+		}
+		return &fileBondStore{path: BondsFile, keepBackups: keep}
+	}
+}
+
+// fileBondStore keeps the bonds in a single json file. It does not keep versions.
+// Every save backs up the previous file and keeps the newest keepBackups copies.
+type fileBondStore struct {
+	path        string
+	keepBackups int
+	mu          sync.Mutex
+}
+
+// Cantidad de backups de bonds.json que se conservan si BONDS_BACKUPS no está definida.
+const defaultBondBackups = 10
+
+func (s *fileBondStore) Load(ctx context.Context) ([]Bond, error) {
+	return readBondsFile(s.path)
+}
+
+func (s *fileBondStore) Save(ctx context.Context, bond Bond, author string, reason string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bonds, err := readBondsFile(s.path)
+	if err != nil {
+		return 0, err
+	}
+	bonds = upsertBond(bonds, bond)
+
+	jsonOut, err := json.Marshal(bonds)
+	if err != nil {
+		return 0, fmt.Errorf("marshal bonds: %w", err)
+	}
+	// backup the file containing the data first
+	if err := backupFile(s.path, s.keepBackups); err != nil {
+		return 0, err
+	}
+	if err := writeFileAtomic(s.path, jsonOut, 0644); err != nil {
+		return 0, fmt.Errorf("write bonds file: %w", err)
+	}
+	return 0, nil
+}
+
+func (s *fileBondStore) History(ctx context.Context, ticker string) ([]BondVersion, error) {
+	return nil, errNoVersioning
+}
+
+func (s *fileBondStore) LoadAsOf(ctx context.Context, version int) ([]Bond, error) {
+	return nil, errNoVersioning
+}
+
+// pgBondStore keeps every version of every bond in the bond_versions table.
+// If the table is empty on first load it is seeded from seedFile.
+type pgBondStore struct {
+	seedFile string
+	pool     pgPool
+	mu       sync.Mutex
+	seeded   bool // the table was already checked and seeded if it was empty
+}
+
+const bondVersionsDDL = `CREATE TABLE IF NOT EXISTS bond_versions (
+	version    BIGSERIAL PRIMARY KEY,
+	ticker     TEXT NOT NULL,
+	data       JSONB NOT NULL,
+	author     TEXT NOT NULL,
+	reason     TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+
+func newPgBondStore(seedFile string) *pgBondStore {
+	return &pgBondStore{seedFile: seedFile, pool: pgPool{ddl: []string{bondVersionsDDL}}}
+}
+
+// open returns the pool of the store, see pgPool.
+func (s *pgBondStore) open(ctx context.Context) (*sql.DB, error) {
+	return s.pool.open(ctx)
+}
+
+func (s *pgBondStore) Load(ctx context.Context) ([]Bond, error) {
+	db, err := s.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	if s.seedFile != "" && !s.seeded {
+		if err := s.seed(ctx, db); err != nil {
+			s.mu.Unlock()
+			return nil, err
+		}
+		s.seeded = true
+	}
+	s.mu.Unlock()
+	return queryBonds(ctx, db, 0)
+}
+
+func (s *pgBondStore) LoadAsOf(ctx context.Context, version int) ([]Bond, error) {
+	if version <= 0 {
+		return nil, fmt.Errorf("invalid bond version %d", version)
+	}
+	db, err := s.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return queryBonds(ctx, db, version)
+}
+
+func (s *pgBondStore) Save(ctx context.Context, bond Bond, author string, reason string) (int, error) {
+	db, err := s.open(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return insertBondVersion(ctx, db, bond, author, reason)
+}
+
+func (s *pgBondStore) History(ctx context.Context, ticker string) ([]BondVersion, error) {
+	db, err := s.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx,
+		`SELECT version, ticker, data, author, reason, created_at FROM bond_versions WHERE ticker = $1 ORDER BY version`,
+		ticker)
+	if err != nil {
+		return nil, fmt.Errorf("query bond history: %w", err)
+	}
+	defer rows.Close()
+
+	var history []BondVersion
+	for rows.Next() {
+		var v BondVersion
+		var data []byte
+		if err := rows.Scan(&v.Version, &v.Ticker, &data, &v.Author, &v.Reason, &v.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		if err := json.Unmarshal(data, &v.Bond); err != nil {
+			return nil, fmt.Errorf("version %d: %w", v.Version, err)
+		}
+		setBondDefaults(&v.Bond)
+		history = append(history, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+	return history, nil
+}
+
+// Carga el contenido de seedFile como primera versión de cada bono si bond_versions está vacía.
+// Todo en una transacción con la tabla bloqueada: un seed que falla a mitad no deja la tabla a medio cargar,
+// y dos instancias arrancando a la vez no la cargan dos veces.
+func (s *pgBondStore) seed(ctx context.Context, db *sql.DB) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin seed: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `LOCK TABLE bond_versions IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return fmt.Errorf("lock bond_versions: %w", err)
+	}
+	var count int
+	if err := tx.QueryRowContext(ctx, `SELECT count(*) FROM bond_versions`).Scan(&count); err != nil {
+		return fmt.Errorf("count bond_versions: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	bonds, err := readBondsFile(s.seedFile)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	inserted := 0
+	for _, bond := range bonds {
+		// getCashFlow siempre usó el primer bono con el ticker, así que los duplicados se descartan.
+		if seen[bond.Ticker] {
+			continue
+		}
+		seen[bond.Ticker] = true
+		if _, err := insertBondVersion(ctx, tx, bond, "seed", "initial import from "+s.seedFile); err != nil {
+			return err
+		}
+		inserted++
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit seed: %w", err)
+	}
+	fmt.Println("bond_versions inicializada desde", s.seedFile, "con", inserted, "bonos")
+	return nil
+}
+
+// queryRower is a *sql.DB or a *sql.Tx.
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func insertBondVersion(ctx context.Context, db queryRower, bond Bond, author string, reason string) (int, error) {
+	data, err := json.Marshal(bond)
+	if err != nil {
+		return 0, fmt.Errorf("marshal bond: %w", err)
+	}
+	var version int
+	err = db.QueryRowContext(ctx,
+		`INSERT INTO bond_versions (ticker, data, author, reason) VALUES ($1, $2, $3, $4) RETURNING version`,
+		bond.Ticker, data, author, reason).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("insert bond version: %w", err)
+	}
+	return version, nil
+}
+
+// Devuelve la última versión de cada bono hasta maxVersion inclusive. maxVersion 0 significa sin límite.
+func queryBonds(ctx context.Context, db *sql.DB, maxVersion int) ([]Bond, error) {
+	query := `SELECT DISTINCT ON (ticker) data FROM bond_versions ORDER BY ticker, version DESC`
+	args := []interface{}{}
+	if maxVersion > 0 {
+		query = `SELECT DISTINCT ON (ticker) data FROM bond_versions WHERE version <= $1 ORDER BY ticker, version DESC`
+		args = append(args, maxVersion)
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query bond_versions: %w", err)
+	}
+	defer rows.Close()
+
+	var bonds []Bond
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		var bond Bond
+		if err := json.Unmarshal(data, &bond); err != nil {
+			return nil, fmt.Errorf("unmarshal bond: %w", err)
+		}
+		setBondDefaults(&bond)
+		bonds = append(bonds, bond)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+	sortBondsByID(bonds)
+	return bonds, nil
+}
+
+func readBondsFile(path string) ([]Bond, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read bonds file: %w", err)
+	}
+	var bonds []Bond
+	if err := json.Unmarshal(data, &bonds); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for i := range bonds {
+		setBondDefaults(&bonds[i])
+	}
+	return bonds, nil
+}
+
+// upsertBond replaces the bond with the same ticker or appends it if it is new.
+func upsertBond(bonds []Bond, bond Bond) []Bond {
+	out := make([]Bond, len(bonds))
+	copy(out, bonds)
+	for i := range out {
+		if out[i].Ticker == bond.Ticker {
+			out[i] = bond
+			return out
+		}
+	}
+	return append(out, bond)
+}
+
+// Ordena los bonos por ID numérico para mantener el orden del json original.
+func sortBondsByID(bonds []Bond) {
+	id := func(b Bond) int {
+		n, _ := strconv.Atoi(b.ID)
+		return n
+	}
+	sort.SliceStable(bonds, func(i, j int) bool { return id(bonds[i]) < id(bonds[j]) })
+}
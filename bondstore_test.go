@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileBondStore(t *testing.T) {
+	tests := []struct {
+		name        string
+		initial     []Bond
+		saves       []Bond
+		keepBackups int
+		want        map[string]float64 // coupon by ticker after the saves
+		wantBackups int
+	}{
+		{
+			name:        "new bond is appended",
+			initial:     []Bond{{Ticker: "AAA", Coupon: 0.01}},
+			saves:       []Bond{{Ticker: "BBB", Coupon: 0.02}},
+			keepBackups: 10,
+			want:        map[string]float64{"AAA": 0.01, "BBB": 0.02},
+			wantBackups: 1,
+		},
+		{
+			name:        "existing bond is replaced",
+			initial:     []Bond{{Ticker: "AAA", Coupon: 0.01}, {Ticker: "BBB", Coupon: 0.02}},
+			saves:       []Bond{{Ticker: "AAA", Coupon: 0.05}},
+			keepBackups: 10,
+			want:        map[string]float64{"AAA": 0.05, "BBB": 0.02},
+			wantBackups: 1,
+		},
+		{
+			name:        "backups are pruned",
+			initial:     []Bond{{Ticker: "AAA", Coupon: 0.01}},
+			saves:       []Bond{{Ticker: "AAA", Coupon: 0.02}, {Ticker: "AAA", Coupon: 0.03}, {Ticker: "AAA", Coupon: 0.04}},
+			keepBackups: 2,
+			want:        map[string]float64{"AAA": 0.04},
+			wantBackups: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "bonds.json")
+			s := &fileBondStore{path: path, keepBackups: tt.keepBackups}
+			if err := writeBondsFixture(path, tt.initial); err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+			for _, b := range tt.saves {
+				if _, err := s.Save(ctx, b, "test", ""); err != nil {
+					t.Fatalf("Save(%s): %v", b.Ticker, err)
+				}
+				time.Sleep(time.Millisecond) // los backups se nombran por hora de creación
+			}
+			bonds, err := s.Load(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(bonds) != len(tt.want) {
+				t.Fatalf("got %d bonds, want %d", len(bonds), len(tt.want))
+			}
+			for _, b := range bonds {
+				if want, ok := tt.want[b.Ticker]; !ok || b.Coupon != want {
+					t.Errorf("%s: coupon %v, want %v", b.Ticker, b.Coupon, want)
+				}
+			}
+			backups, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "bonds_*.json"))
+			if len(backups) != tt.wantBackups {
+				t.Errorf("got %d backups, want %d", len(backups), tt.wantBackups)
+			}
+			if _, err := s.History(ctx, "AAA"); err != errNoVersioning {
+				t.Errorf("History: got %v, want errNoVersioning", err)
+			}
+		})
+	}
+}
+
+func writeBondsFixture(path string, bonds []Bond) error {
+	data, err := json.Marshal(bonds)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0644)
+}
+
+// TestPgBondStore runs against the database of the POSTGRES_* variables. It adds versions of a test ticker
+// to bond_versions, so point it to a scratch database.
+func TestPgBondStore(t *testing.T) {
+	if os.Getenv("POSTGRES_HOST") == "" {
+		t.Skip("POSTGRES_HOST is not set")
+	}
+	ctx := context.Background()
+	s := newPgBondStore("")
+	ticker := fmt.Sprintf("TEST%d", time.Now().UnixNano())
+
+	tests := []struct {
+		coupon float64
+		reason string
+	}{
+		{0.01, "first"},
+		{0.02, "second"},
+		{0.03, "third"},
+	}
+	versions := make([]int, len(tests))
+	for i, tt := range tests {
+		v, err := s.Save(ctx, Bond{Ticker: ticker, Coupon: tt.coupon}, "test", tt.reason)
+		if err != nil {
+			t.Fatalf("Save %s: %v", tt.reason, err)
+		}
+		if i > 0 && v <= versions[i-1] {
+			t.Fatalf("version %d is not after %d", v, versions[i-1])
+		}
+		versions[i] = v
+	}
+
+	history, err := s.History(ctx, ticker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != len(tests) {
+		t.Fatalf("got %d versions, want %d", len(history), len(tests))
+	}
+	for i, tt := range tests {
+		if history[i].Version != versions[i] || history[i].Bond.Coupon != tt.coupon || history[i].Reason != tt.reason {
+			t.Errorf("version %d: got %+v", i, history[i])
+		}
+
+		bonds, err := s.LoadAsOf(ctx, versions[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b, ok := findBond(bonds, ticker); !ok {
+			t.Errorf("LoadAsOf(%d): %s not found", versions[i], ticker)
+		} else if b.Coupon != tt.coupon {
+			t.Errorf("LoadAsOf(%d): coupon %v, want %v", versions[i], b.Coupon, tt.coupon)
+		}
+	}
+
+	bonds, err := s.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, ok := findBond(bonds, ticker); !ok || b.Coupon != tests[len(tests)-1].coupon {
+		t.Errorf("Load: want the last version of %s", ticker)
+	}
+}
+
+func findBond(bonds []Bond, ticker string) (Bond, bool) {
+	for _, b := range bonds {
+		if b.Ticker == ticker {
+			return b, true
+		}
+	}
+	return Bond{}, false
+}
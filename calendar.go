@@ -2,74 +2,104 @@ package main
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
-	"os"
+	"strings"
+	"sync"
 	"time"
 
-	_ "github.com/lib/pq"
 	"github.com/rickar/cal/v2"
+	"github.com/rickar/cal/v2/us"
 )
 
-var calendar = cal.NewBusinessCalendar()
+// Names of the market calendars. Bonds choose one with their Calendar field, AR is the default.
+const (
+	CalendarAR      = "AR"    // Argentina, holidays loaded from the holiday source
+	CalendarNY      = "NY"    // New York, US federal holidays (the ones observed by the NY payment system)
+	CalendarARandNY = "AR+NY" // business day only if it is one in both Argentina and New York
+)
+
+// Roll conventions used to move a cashflow date that falls on a non business day.
+const (
+	RollUnadjusted        = "Unadjusted"        // the date is kept (default, as the dates in bonds.json)
+	RollFollowing         = "Following"         // next business day
+	RollModifiedFollowing = "ModifiedFollowing" // next business day unless it falls in the next month, then previous
+	RollPreceding         = "Preceding"         // previous business day
+)
+
+var (
+	calendarsMu sync.RWMutex
+	calendars   = buildCalendars(nil)
+)
+
+// Source of the holidays. Chosen once with HOLIDAYS_SOURCE, see newHolidaySource, since the scheduler
+// and the startup retry load the holidays concurrently.
+var (
+	holidaySourceOnce sync.Once
+	holidaySource     HolidaySource
+	holidaySourceErr  error
+)
+
+func currentHolidaySource() (HolidaySource, error) {
+	holidaySourceOnce.Do(func() {
+		holidaySource, holidaySourceErr = newHolidaySource()
+	})
+	return holidaySource, holidaySourceErr
+}
 
-// Carga inicial y programa recarga diaria desde Postgres.
+// Carga inicial de feriados. Si falla se reintenta cada 1 minuto en background, como los índices, para no quedar
+// sin feriados (y con los bonos indexados en 503) hasta el próximo job semanal. La recarga la programa el scheduler (job "holidays").
 func SetUpCalendar() {
-	ctx := context.Background()
-	if err := LoadHolidaysFromDB(ctx); err != nil {
-		fmt.Println("No se pudieron cargar feriados desde DB:", err)
+	if _, err := LoadHolidays(context.Background()); err != nil {
+		fmt.Println("No se pudieron cargar feriados:", err)
+		go LoadHolidaysWithRetry(context.Background(), time.Minute)
 	}
-	// Recarga diaria
-	t := time.NewTicker(24 * time.Hour)
-	go func() {
-		for range t.C {
-			if err := LoadHolidaysFromDB(ctx); err != nil {
-				fmt.Println("Recarga de feriados falló:", err)
-			} else {
-				fmt.Println("Feriados recargados desde DB")
-			}
+}
+
+// LoadHolidaysWithRetry carga los feriados reintentando cada interval hasta que lo logra o ctx se cancela.
+func LoadHolidaysWithRetry(ctx context.Context, interval time.Duration) {
+	for {
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			fmt.Println("holidays retry canceled:", ctx.Err())
+			return
+		}
+		if n, err := LoadHolidays(ctx); err == nil {
+			fmt.Println("holidays loaded successfully:", n)
+			return
 		}
-	}()
+		fmt.Println("Error loading holidays, retry in", interval)
+	}
 }
 
-// Re-carga feriados desde la tabla `calendario_feriados`.
-// Espera columnas: date (DATE/TIMESTAMP) y name (TEXT).
-func LoadHolidaysFromDB(ctx context.Context) error {
-	dbUser := os.Getenv("POSTGRES_USER")
-	dbPassword := os.Getenv("POSTGRES_PASSWORD")
-	dbHost := os.Getenv("POSTGRES_HOST")
-	dbPort := os.Getenv("POSTGRES_PORT")
-	dbName := os.Getenv("POSTGRES_DB")
-
-	connStr := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		dbHost, dbPort, dbUser, dbPassword, dbName,
-	)
-	db, err := sql.Open("postgres", connStr)
+// Re-carga feriados desde la fuente configurada (por defecto la tabla "calendarioFeriados" de Postgres).
+// Devuelve la cantidad de feriados cargados.
+func LoadHolidays(ctx context.Context) (int, error) {
+	src, err := currentHolidaySource()
 	if err != nil {
-		return fmt.Errorf("open db: %w", err)
+		markDependency(depHolidays, 0, err)
+		return 0, err
 	}
-	defer db.Close()
-
-	if err := db.PingContext(ctx); err != nil {
-		return fmt.Errorf("ping db: %w", err)
+	dates, err := src.LoadHolidays(ctx)
+	markDependency(depHolidays, len(dates), err)
+	if err != nil {
+		return 0, err
 	}
 
-	// Ajusta los nombres de columnas si en tu tabla difieren.
-	rows, err := db.QueryContext(ctx, `SELECT date FROM "calendarioFeriados"`)
-	if err != nil {
-		return fmt.Errorf("query feriados: %w", err)
+	calendarsMu.Lock()
+	calendars = buildCalendars(dates)
+	calendarsMu.Unlock()
+	if err := snapshots.Save(snapshotHolidays, src.Describe(), dates); err != nil {
+		fmt.Println("No se pudo guardar el snapshot de feriados:", err)
 	}
-	defer rows.Close()
+	fmt.Println("Feriados cargados desde", src.Describe()+":", len(dates))
+	return len(dates), nil
+}
 
+// Arma un calendario de días hábiles con los feriados dados.
+func newCalendarWithHolidays(dates []time.Time) *cal.BusinessCalendar {
 	newCal := cal.NewBusinessCalendar()
-
-	var d time.Time
-	count := 0
-	for rows.Next() {
-		if err := rows.Scan(&d); err != nil {
-			return fmt.Errorf("scan: %w", err)
-		}
+	for _, d := range dates {
 		y, m, day := d.Date()
 		h := &cal.Holiday{
 			Name:      "Feriado",
@@ -81,13 +111,109 @@ func LoadHolidaysFromDB(ctx context.Context) error {
 			Func:      cal.CalcDayOfMonth,
 		}
 		newCal.AddHoliday(h)
-		count++
 	}
-	if err := rows.Err(); err != nil {
-		return fmt.Errorf("rows: %w", err)
+	return newCal
+}
+
+// buildCalendars arma todos los calendarios a partir de los feriados argentinos.
+// El mapa no se modifica después de armado: una recarga lo reemplaza entero.
+func buildCalendars(arDates []time.Time) map[string]*cal.BusinessCalendar {
+	ar := newCalendarWithHolidays(arDates)
+	joint := newNYCalendar()
+	joint.AddHoliday(ar.Holidays...)
+	return map[string]*cal.BusinessCalendar{
+		CalendarAR:      ar,
+		CalendarNY:      newNYCalendar(),
+		CalendarARandNY: joint,
 	}
+}
 
-	calendar = newCal
-	fmt.Println("Feriados cargados desde DB:", count)
-	return nil
+// New York business calendar: US federal holidays, Juneteenth included.
+func newNYCalendar() *cal.BusinessCalendar {
+	c := cal.NewBusinessCalendar()
+	c.AddHoliday(us.Holidays...)
+	c.AddHoliday(us.Juneteenth)
+	return c
+}
+
+// normalizeCalendar maps the accepted spellings to a calendar name. Empty means AR.
+func normalizeCalendar(name string) (string, error) {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "", "AR", "BA":
+		return CalendarAR, nil
+	case "NY", "US", "US/NY":
+		return CalendarNY, nil
+	case "AR+NY", "NY+AR", "AR+US", "JOINT":
+		return CalendarARandNY, nil
+	}
+	return "", fmt.Errorf("unknown calendar %q", name)
+}
+
+// getCalendar returns the business calendar with the given name (see normalizeCalendar).
+func getCalendar(name string) (*cal.BusinessCalendar, error) {
+	n, err := normalizeCalendar(name)
+	if err != nil {
+		return nil, err
+	}
+	calendarsMu.RLock()
+	defer calendarsMu.RUnlock()
+	return calendars[n], nil
+}
+
+// arCalendar is the Argentine calendar, used for the index offsets.
+func arCalendar() *cal.BusinessCalendar {
+	c, _ := getCalendar(CalendarAR)
+	return c
+}
+
+// normalizeRoll maps the accepted spellings to a roll convention. Empty means Unadjusted.
+func normalizeRoll(roll string) (string, error) {
+	switch strings.ToLower(strings.ReplaceAll(strings.TrimSpace(roll), " ", "")) {
+	case "", "unadjusted", "none":
+		return RollUnadjusted, nil
+	case "following", "f":
+		return RollFollowing, nil
+	case "modifiedfollowing", "mf":
+		return RollModifiedFollowing, nil
+	case "preceding", "p":
+		return RollPreceding, nil
+	}
+	return "", fmt.Errorf("unknown roll convention %q", roll)
+}
+
+// rollDate moves date to a business day of c following the convention.
+func rollDate(date time.Time, c *cal.BusinessCalendar, roll string) time.Time {
+	if roll == RollUnadjusted || c.IsWorkday(date) {
+		return date
+	}
+	switch roll {
+	case RollFollowing:
+		return c.WorkdaysFrom(date, 1)
+	case RollPreceding:
+		return c.WorkdaysFrom(date, -1)
+	case RollModifiedFollowing:
+		next := c.WorkdaysFrom(date, 1)
+		if next.Month() != date.Month() {
+			return c.WorkdaysFrom(date, -1)
+		}
+		return next
+	}
+	return date
+}
+
+// adjustCashflow returns a copy of the bond's cashflow with the dates rolled on c.
+func adjustCashflow(b Bond, c *cal.BusinessCalendar) ([]Flujo, error) {
+	roll, err := normalizeRoll(b.Roll)
+	if err != nil {
+		return nil, err
+	}
+	flow := make([]Flujo, len(b.Cashflow))
+	copy(flow, b.Cashflow)
+	if roll == RollUnadjusted {
+		return flow, nil
+	}
+	for i := range flow {
+		flow[i].Date = Fecha(rollDate(time.Time(flow[i].Date), c, roll))
+	}
+	return flow, nil
 }
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNormalizeRoll(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"", RollUnadjusted, false},
+		{"none", RollUnadjusted, false},
+		{"Following", RollFollowing, false},
+		{"F", RollFollowing, false},
+		{"Modified Following", RollModifiedFollowing, false},
+		{"mf", RollModifiedFollowing, false},
+		{"preceding", RollPreceding, false},
+		{"nearest", "", true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeRoll(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("normalizeRoll(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestRollDate(t *testing.T) {
+	// feriados argentinos: lunes 2024-06-17, jueves 20 y viernes 21, y 2024-12-31 y 2025-01-01 para probar el fin de mes y de año
+	calendars := buildCalendars(append([]time.Time{mustDate("2024-12-31"), mustDate("2025-01-01")}, arHolidays2024...))
+	tests := []struct {
+		name     string
+		date     string
+		calendar string
+		roll     string
+		want     string
+	}{
+		{"business day is kept", "2024-06-18", CalendarAR, RollFollowing, "2024-06-18"},
+		{"unadjusted keeps a holiday", "2024-06-17", CalendarAR, RollUnadjusted, "2024-06-17"},
+		{"following skips the holiday", "2024-06-17", CalendarAR, RollFollowing, "2024-06-18"},
+		{"following skips the weekend and the holidays", "2024-06-20", CalendarAR, RollFollowing, "2024-06-24"},
+		{"preceding", "2024-06-17", CalendarAR, RollPreceding, "2024-06-14"},
+		{"modified following in the month", "2024-06-17", CalendarAR, RollModifiedFollowing, "2024-06-18"},
+		{"modified following goes back at month-end", "2024-06-29", CalendarAR, RollModifiedFollowing, "2024-06-28"},
+		{"modified following goes back at year-end", "2024-12-31", CalendarAR, RollModifiedFollowing, "2024-12-30"},
+		{"following across year-end", "2024-12-31", CalendarAR, RollFollowing, "2025-01-02"},
+		{"NY ignores the Argentine holidays", "2024-06-17", CalendarNY, RollFollowing, "2024-06-17"},
+		{"NY closes on Juneteenth", "2024-06-19", CalendarNY, RollFollowing, "2024-06-20"},
+		{"AR+NY closes on the holidays of both", "2024-06-19", CalendarARandNY, RollFollowing, "2024-06-24"},
+		{"AR+NY preceding", "2024-06-21", CalendarARandNY, RollPreceding, "2024-06-18"},
+		{"AR+NY closes on Independence Day", "2024-07-04", CalendarARandNY, RollFollowing, "2024-07-05"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rollDate(mustDate(tt.date), calendars[tt.calendar], tt.roll)
+			if got.Format(DateFormat) != tt.want {
+				t.Errorf("got %s, want %s", got.Format("2006-01-02 Mon"), tt.want)
+			}
+		})
+	}
+}
+
+func TestAdjustCashflow(t *testing.T) {
+	calendars := buildCalendars(arHolidays2024)
+	b := Bond{Ticker: "GDX", Cashflow: []Flujo{
+		{Date: Fecha(mustDate("2024-06-17")), Amount: 1},
+		{Date: Fecha(mustDate("2024-06-19")), Amount: 1},
+		{Date: Fecha(mustDate("2024-07-04")), Amount: 101},
+	}}
+	tests := []struct {
+		name     string
+		calendar string
+		roll     string
+		want     []string
+		wantErr  bool
+	}{
+		{"unadjusted", CalendarAR, "", []string{"2024-06-17", "2024-06-19", "2024-07-04"}, false},
+		{"AR following", CalendarAR, "Following", []string{"2024-06-18", "2024-06-19", "2024-07-04"}, false},
+		{"NY following", CalendarNY, "Following", []string{"2024-06-17", "2024-06-20", "2024-07-05"}, false},
+		{"AR+NY following", CalendarARandNY, "Following", []string{"2024-06-18", "2024-06-24", "2024-07-05"}, false},
+		{"unknown roll", CalendarAR, "nearest", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bond := b
+			bond.Roll = tt.roll
+			flow, err := adjustCashflow(bond, calendars[tt.calendar])
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, want := range tt.want {
+				if got := flow[i].Date.Format(DateFormat); got != want || flow[i].Amount != b.Cashflow[i].Amount {
+					t.Errorf("payment %d on %s, want %s", i, got, want)
+				}
+			}
+			if b.Cashflow[0].Date.Format(DateFormat) != "2024-06-17" {
+				t.Error("the cashflow of the bond was modified")
+			}
+		})
+	}
+}
+
+// A bond with a bad Roll is reported as such, not as an unknown ticker.
+func TestBadRollIsNotAnUnknownTicker(t *testing.T) {
+	bad := cerBond
+	bad.ID, bad.Ticker, bad.Index, bad.Roll = "T3", "TXT3", "", "nearest"
+	setTestMarket(t, []Bond{bad}, dailyCER("2023-12-01", "2024-06-30"), nil)
+
+	query := "?settlementDate=2024-05-15&initialFee=0&endingFee=0&price=100&rate=0.05"
+	for _, handler := range []gin.HandlerFunc{yieldWrapper, priceWrapper} {
+		code, out := getJSON(t, handler, "/yield"+query+"&ticker=TXT3")
+		if code != http.StatusBadRequest || out["Error in Calendar. "] == nil {
+			t.Errorf("bad roll: %d %v, want 400 Error in Calendar", code, out)
+		}
+		if code, out = getJSON(t, handler, "/yield"+query+"&ticker=ZZZ"); code != http.StatusNotFound {
+			t.Errorf("unknown ticker: %d %v, want 404", code, out)
+		}
+	}
+}
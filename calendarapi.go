@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rickar/cal/v2"
+)
+
+// Máximo rango de días que aceptan los endpoints de calendario.
+const maxCalendarRangeDays = 366 * 30
+
+// holidayOut is one holiday as returned by /calendar/holidays.
+type holidayOut struct {
+	Date Fecha
+	Name string
+}
+
+// calendarFromQuery returns the calendar named by the calendar param (AR by default) and its normalized name,
+// with the holidays of asOf if given, as the pricing endpoints use.
+func calendarFromQuery(c *gin.Context) (*cal.BusinessCalendar, string, error) {
+	name, err := normalizeCalendar(c.Query("calendar"))
+	if err != nil {
+		return nil, "", err
+	}
+	md, err := marketDataForRequest(c)
+	if err != nil {
+		return nil, "", err
+	}
+	bc, err := md.calendar(name)
+	return bc, name, err
+}
+
+func dateRangeFromQuery(c *gin.Context) (time.Time, time.Time, error) {
+	from, err := time.Parse(DateFormat, c.Query("from"))
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("invalid from date")
+	}
+	to, err := time.Parse(DateFormat, c.Query("to"))
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("invalid to date")
+	}
+	if to.Sub(from).Hours()/24 > maxCalendarRangeDays || from.Sub(to).Hours()/24 > maxCalendarRangeDays {
+		return time.Time{}, time.Time{}, errors.New("date range too long")
+	}
+	return from, to, nil
+}
+
+// businessDaysBetween counts the business days in (from, to], so that WorkdaysFrom(from, n) == to
+// when to is a business day. It is negative when to is before from.
+func businessDaysBetween(bc *cal.BusinessCalendar, from time.Time, to time.Time) int {
+	sign := 1
+	if to.Before(from) {
+		from, to = to, from
+		sign = -1
+	}
+	n := 0
+	for d := from.AddDate(0, 0, 1); !d.After(to); d = d.AddDate(0, 0, 1) {
+		if bc.IsWorkday(d) {
+			n++
+		}
+	}
+	return sign * n
+}
+
+// holidaysWrapper lists the holidays (observed dates) of a calendar between from and to inclusive.
+func holidaysWrapper(c *gin.Context) {
+	bc, name, err := calendarFromQuery(c)
+	if err != nil {
+		c.JSON(indexErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	from, to, err := dateRangeFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	holidays := []holidayOut{}
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		if _, observed, h := bc.IsHoliday(d); observed {
+			holidays = append(holidays, holidayOut{Date: Fecha(d), Name: h.Name})
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"Calendar": name,
+		"From":     Fecha(from),
+		"To":       Fecha(to),
+		"Holidays": holidays,
+	})
+}
+
+// isBusinessDayWrapper tells whether date is a business day of the calendar.
+func isBusinessDayWrapper(c *gin.Context) {
+	bc, name, err := calendarFromQuery(c)
+	if err != nil {
+		c.JSON(indexErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	date, err := time.Parse(DateFormat, c.Query("date"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid date"})
+		return
+	}
+	out := gin.H{
+		"Calendar":    name,
+		"Date":        Fecha(date),
+		"BusinessDay": bc.IsWorkday(date),
+		"Weekend":     date.Weekday() == time.Saturday || date.Weekday() == time.Sunday,
+	}
+	if _, observed, h := bc.IsHoliday(date); observed {
+		out["Holiday"] = h.Name
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// addBusinessDaysWrapper adds (or subtracts, if days is negative) business days to date,
+// the same way the index offsets are applied.
+func addBusinessDaysWrapper(c *gin.Context) {
+	bc, name, err := calendarFromQuery(c)
+	if err != nil {
+		c.JSON(indexErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	date, err := time.Parse(DateFormat, c.Query("date"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid date"})
+		return
+	}
+	days, err := strconv.Atoi(c.Query("days"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid days"})
+		return
+	}
+	if days > maxCalendarRangeDays || days < -maxCalendarRangeDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "days out of range"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"Calendar": name,
+		"Date":     Fecha(date),
+		"Days":     days,
+		"Result":   Fecha(bc.WorkdaysFrom(date, days)),
+	})
+}
+
+// businessDaysWrapper counts the business days between two dates, see businessDaysBetween.
+func businessDaysWrapper(c *gin.Context) {
+	bc, name, err := calendarFromQuery(c)
+	if err != nil {
+		c.JSON(indexErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	from, to, err := dateRangeFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"Calendar":     name,
+		"From":         Fecha(from),
+		"To":           Fecha(to),
+		"BusinessDays": businessDaysBetween(bc, from, to),
+		"CalendarDays": int(to.Sub(from).Hours() / 24),
+	})
+}
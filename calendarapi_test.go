@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBusinessDaysBetween(t *testing.T) {
+	calendars := buildCalendars(arHolidays2024)
+	tests := []struct {
+		name     string
+		from     string
+		to       string
+		calendar string
+		want     int
+	}{
+		{"same day", "2024-06-18", "2024-06-18", CalendarAR, 0},
+		{"next day", "2024-06-18", "2024-06-19", CalendarAR, 1},
+		{"over the weekend and the holiday Monday", "2024-06-14", "2024-06-18", CalendarAR, 1},
+		{"to a holiday", "2024-06-19", "2024-06-21", CalendarAR, 0},
+		{"backwards", "2024-06-18", "2024-06-14", CalendarAR, -1},
+		{"NY counts the Argentine holidays", "2024-06-14", "2024-06-18", CalendarNY, 2},
+		{"AR+NY skips the holidays of both", "2024-06-14", "2024-06-28", CalendarARandNY, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := calendars[tt.calendar]
+			from, to := mustDate(tt.from), mustDate(tt.to)
+			got := businessDaysBetween(bc, from, to)
+			if got != tt.want {
+				t.Fatalf("got %d, want %d", got, tt.want)
+			}
+			// addbusinessdays(from, BusinessDays) vuelve a to cuando to es hábil
+			if bc.IsWorkday(to) && !bc.WorkdaysFrom(from, got).Equal(to) {
+				t.Errorf("WorkdaysFrom(%s, %d) = %s, want %s", tt.from, got, bc.WorkdaysFrom(from, got).Format(DateFormat), tt.to)
+			}
+		})
+	}
+}
+
+// useSnapshots makes the service keep its snapshots in a temporary directory and puts back the store when the test ends.
+func useSnapshots(t *testing.T) *snapshotStore {
+	t.Helper()
+	prev := snapshots
+	snapshots = &snapshotStore{dir: t.TempDir(), last: make(map[string][]byte)}
+	t.Cleanup(func() { snapshots = prev })
+	return snapshots
+}
+
+// The calendar endpoints use the holidays known at asOf, as the pricing endpoints do.
+func TestCalendarAsOf(t *testing.T) {
+	setTestMarket(t, nil, nil, nil)
+	if err := useSnapshots(t).Save(snapshotHolidays, "test", arHolidays2024); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute).UTC().Format(time.RFC3339)
+	tests := []struct {
+		name     string
+		query    string
+		code     int
+		business bool
+	}{
+		{"current holidays", "?date=2024-06-17", http.StatusOK, true},
+		{"holidays of asOf", "?date=2024-06-17&asOf=" + later, http.StatusOK, false},
+		{"no snapshot before asOf", "?date=2024-06-17&asOf=2000-01-01", http.StatusServiceUnavailable, false},
+		{"bad asOf", "?date=2024-06-17&asOf=yesterday", http.StatusBadRequest, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, out := getJSON(t, isBusinessDayWrapper, "/calendar/isbusinessday"+tt.query)
+			if code != tt.code {
+				t.Fatalf("status %d, want %d: %v", code, tt.code, out)
+			}
+			if code == http.StatusOK && out["BusinessDay"] != tt.business {
+				t.Errorf("BusinessDay %v, want %v", out["BusinessDay"], tt.business)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Redemption is a date on which the bond can be redeemed before maturity at Price per 100 of the
+// outstanding face value: by the issuer (Bond.Calls) or by the holder (Bond.Puts).
+type Redemption struct {
+	Date  Fecha
+	Price float64
+}
+
+// Ways a bond can end.
+const (
+	RedeemMaturity = "maturity"
+	RedeemCall     = "call"
+	RedeemPut      = "put"
+)
+
+// redemptionFlow is the cashflow of the bond if it ends at Date (maturity, call or put).
+type redemptionFlow struct {
+	Kind  string
+	Date  time.Time
+	Price float64
+	flow  []Flujo
+}
+
+// redemptionOut is the yield or price of the bond to one of its redemptions.
+type redemptionOut struct {
+	Kind            string
+	Date            Fecha
+	RedemptionPrice float64
+	Yield           *float64 `json:",omitempty"`
+	Price           *float64 `json:",omitempty"`
+}
+
+// isCallable reports whether the bond can be redeemed before maturity.
+func (b Bond) isCallable() bool {
+	return len(b.Calls) > 0 || len(b.Puts) > 0
+}
+
+// validateRedemptions checks the call and put schedules: positive prices and dates between issue and maturity.
+func validateRedemptions(b Bond) []string {
+	var problems []string
+	check := func(kind string, list []Redemption) {
+		for _, r := range list {
+			d := time.Time(r.Date)
+			if r.Price <= 0 {
+				problems = append(problems, fmt.Sprintf("%s on %s: price should be greater than 0", kind, r.Date.Format(DateFormat)))
+			}
+			if !d.After(time.Time(b.IssueDate)) || d.After(time.Time(b.Maturity)) {
+				problems = append(problems, fmt.Sprintf("%s on %s: date should be after the issue date and not after maturity", kind, r.Date.Format(DateFormat)))
+			}
+		}
+	}
+	check(RedeemCall, b.Calls)
+	check(RedeemPut, b.Puts)
+	return problems
+}
+
+// truncateCashflow returns the cashflow of a bond redeemed on date at price per 100 of the outstanding face value:
+// the payments before date are kept and on date the outstanding face value is paid at price, plus the coupon
+// due that day or, between payments, the interest accrued since the previous one (days/360, as extendedInfo).
+func truncateCashflow(flow []Flujo, issueDate time.Time, date time.Time, price float64) []Flujo {
+	out := []Flujo{}
+	outstanding := 100.0
+	last := issueDate
+	for _, cf := range flow {
+		d := time.Time(cf.Date)
+		if d.Before(date) {
+			out = append(out, cf)
+			outstanding = cf.Residual // sigue amortizaciones y capitalizaciones, ver faceStateAt
+			last = d
+			continue
+		}
+		interest := cf.Rate * outstanding * date.Sub(last).Hours() / 24 / 360
+		if d.Equal(date) {
+			interest = cf.Amount - cf.Amort
+		}
+		out = append(out, Flujo{
+			Date:     Fecha(date),
+			Rate:     cf.Rate,
+			Amort:    outstanding,
+			Residual: 0,
+			Amount:   interest + outstanding*price/100,
+		})
+		break
+	}
+	return out
+}
+
+// redemptionFlows returns the cashflow to maturity (always first) and to each call and put date after settlementDate,
+// with the payments a buyer settling on settlementDate is entitled to. Call and put dates are rolled like the payments of the bond.
+func (md *marketData) redemptionFlows(b Bond, flow []Flujo, settlementDate time.Time) ([]redemptionFlow, error) {
+	out := []redemptionFlow{{Kind: RedeemMaturity, Date: time.Time(b.Maturity), Price: 100, flow: flow}}
+	c, err := md.calendar(b.Calendar)
+	if err != nil {
+		return nil, err
+	}
+	roll, err := normalizeRoll(b.Roll)
+	if err != nil {
+		return nil, err
+	}
+	add := func(kind string, list []Redemption) {
+		for _, r := range list {
+			d := rollDate(time.Time(r.Date), c, roll)
+			if !d.After(settlementDate) {
+				continue
+			}
+			out = append(out, redemptionFlow{Kind: kind, Date: d, Price: r.Price, flow: truncateCashflow(flow, time.Time(b.IssueDate), d, r.Price)})
+		}
+	}
+	add(RedeemCall, b.Calls)
+	add(RedeemPut, b.Puts)
+	// payments in their ex-coupon period are the seller's, see entitledCashflow
+	for i := range out {
+		out[i].flow = entitledCashflow(out[i].flow, settlementDate, b.RecordDays, c)
+	}
+	sort.SliceStable(out[1:], func(i, j int) bool { return out[i+1].Date.Before(out[j+1].Date) })
+	return out, nil
+}
+
+// yieldsToRedemption computes the yield to every redemption at price. Yield to worst is the lowest and yield to best
+// the highest of the yields to all of them: maturity, each call and each put.
+func yieldsToRedemption(rfs []redemptionFlow, price float64, settlementDate time.Time, initialFee float64, endingFee float64) ([]redemptionOut, redemptionOut, redemptionOut, error) {
+	var all []redemptionOut
+	var worst, best redemptionOut
+	for i, rf := range rfs {
+		y, err, _ := Yield(rf.flow, price, settlementDate, initialFee, endingFee)
+		if err != nil {
+			return nil, worst, best, fmt.Errorf("yield to %s on %s: %w", rf.Kind, rf.Date.Format(DateFormat), err)
+		}
+		out := redemptionOut{Kind: rf.Kind, Date: Fecha(rf.Date), RedemptionPrice: rf.Price, Yield: &y}
+		all = append(all, out)
+		if i == 0 || y < *worst.Yield {
+			worst = out
+		}
+		if i == 0 || y > *best.Yield {
+			best = out
+		}
+	}
+	return all, worst, best, nil
+}
+
+// priceToRedemption prices the bond at rate to every redemption and returns the price to worst: the lowest of the
+// prices to all of them (maturity, each call and each put) and the cashflow of that redemption.
+func priceToRedemption(rfs []redemptionFlow, rate float64, settlementDate time.Time, initialFee float64, endingFee float64) ([]redemptionOut, redemptionOut, []Flujo, error) {
+	var all []redemptionOut
+	var used redemptionOut
+	var usedFlow []Flujo
+	worst := -1
+	prices := make([]float64, len(rfs))
+	for i, rf := range rfs {
+		p, err, _ := Price(rf.flow, rate, settlementDate, initialFee, endingFee)
+		if err != nil {
+			return nil, used, nil, fmt.Errorf("price to %s on %s: %w", rf.Kind, rf.Date.Format(DateFormat), err)
+		}
+		prices[i] = p
+		all = append(all, redemptionOut{Kind: rf.Kind, Date: Fecha(rf.Date), RedemptionPrice: rf.Price, Price: &prices[i]})
+		if worst < 0 || p < prices[worst] {
+			worst = i
+		}
+	}
+	used, usedFlow = all[worst], rfs[worst].flow
+	return all, used, usedFlow, nil
+}
+
+// splitRedemptions separates the redemptions by kind for the responses.
+func splitRedemptions(all []redemptionOut) (calls []redemptionOut, puts []redemptionOut) {
+	calls, puts = []redemptionOut{}, []redemptionOut{}
+	for _, r := range all {
+		switch r.Kind {
+		case RedeemCall:
+			calls = append(calls, r)
+		case RedeemPut:
+			puts = append(puts, r)
+		}
+	}
+	return calls, puts
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTruncateCashflow(t *testing.T) {
+	b := tenPercentBond("CLL")
+	tests := []struct {
+		name     string
+		date     string
+		price    float64
+		payments int
+		last     float64 // amount paid on the redemption date
+	}{
+		{"on a payment date", "2026-01-02", 100, 2, 10 + 100},
+		{"above par", "2026-01-02", 102, 2, 10 + 102},
+		// 181 días de interés corrido desde el pago anterior
+		{"between payments", "2026-07-02", 100, 3, 0.1*100*181/360 + 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flow := truncateCashflow(b.Cashflow, mustDate("2024-01-02"), mustDate(tt.date), tt.price)
+			if len(flow) != tt.payments {
+				t.Fatalf("%d payments, want %d", len(flow), tt.payments)
+			}
+			last := flow[len(flow)-1]
+			if last.Date.Format(DateFormat) != tt.date || math.Abs(last.Amount-tt.last) > 1e-9 || last.Residual != 0 || last.Amort != 100 {
+				t.Errorf("last payment %+v, want %v on %s", last, tt.last, tt.date)
+			}
+		})
+	}
+}
+
+func TestYieldsToRedemption(t *testing.T) {
+	md := &marketData{calendars: buildCalendars(nil), gapPolicy: GapError}
+	settle := mustDate("2025-01-03")
+	plain := tenPercentBond("PLN")
+	callable := tenPercentBond("CLL")
+	callable.Calls = []Redemption{{Date: Fecha(mustDate("2027-01-02")), Price: 100}, {Date: Fecha(mustDate("2026-01-02")), Price: 100}}
+	putable := tenPercentBond("PUT")
+	putable.Puts = []Redemption{{Date: Fecha(mustDate("2026-01-02")), Price: 100}}
+	tests := []struct {
+		name  string
+		bond  Bond
+		price float64
+		worst string // kind and date of the redemption of the yield to worst
+		best  string
+	}{
+		{"plain", plain, 100, "maturity 2029-01-02", "maturity 2029-01-02"},
+		// sobre la par el call más cercano rinde menos, bajo la par rinde más
+		{"callable above par", callable, 105, "call 2026-01-02", "maturity 2029-01-02"},
+		{"callable below par", callable, 95, "maturity 2029-01-02", "call 2026-01-02"},
+		{"putable below par", putable, 95, "maturity 2029-01-02", "put 2026-01-02"},
+		{"putable above par", putable, 105, "put 2026-01-02", "maturity 2029-01-02"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rfs, err := md.redemptionFlows(tt.bond, tt.bond.Cashflow, settle)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rfs[0].Kind != RedeemMaturity {
+				t.Errorf("first redemption %s, want maturity", rfs[0].Kind)
+			}
+			for i := 2; i < len(rfs); i++ {
+				if rfs[i].Date.Before(rfs[i-1].Date) {
+					t.Error("calls and puts are not sorted by date")
+				}
+			}
+			all, worst, best, err := yieldsToRedemption(rfs, tt.price, settle, 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(all) != len(rfs) {
+				t.Fatalf("%d yields for %d redemptions", len(all), len(rfs))
+			}
+			describe := func(r redemptionOut) string { return r.Kind + " " + r.Date.Format(DateFormat) }
+			if describe(worst) != tt.worst || describe(best) != tt.best {
+				t.Errorf("worst %s best %s, want %s and %s", describe(worst), describe(best), tt.worst, tt.best)
+			}
+			for _, r := range all {
+				if *r.Yield < *worst.Yield || *r.Yield > *best.Yield {
+					t.Errorf("yield to %s %v outside [%v, %v]", describe(r), *r.Yield, *worst.Yield, *best.Yield)
+				}
+			}
+		})
+	}
+}
+
+func TestPriceToRedemption(t *testing.T) {
+	md := &marketData{calendars: buildCalendars(nil), gapPolicy: GapError}
+	settle := mustDate("2025-01-03")
+	callable := tenPercentBond("CLL")
+	callable.Calls = []Redemption{{Date: Fecha(mustDate("2026-01-02")), Price: 100}}
+	putable := tenPercentBond("PUT")
+	putable.Puts = []Redemption{{Date: Fecha(mustDate("2026-01-02")), Price: 100}}
+	tests := []struct {
+		name string
+		bond Bond
+		rate float64
+		used string
+	}{
+		{"callable at a low rate is priced to the call", callable, 0.05, RedeemCall},
+		{"callable at a high rate is priced to maturity", callable, 0.15, RedeemMaturity},
+		{"putable at a high rate is priced to maturity", putable, 0.15, RedeemMaturity},
+		{"putable at a low rate is priced to the put", putable, 0.05, RedeemPut},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rfs, err := md.redemptionFlows(tt.bond, tt.bond.Cashflow, settle)
+			if err != nil {
+				t.Fatal(err)
+			}
+			all, used, flow, err := priceToRedemption(rfs, tt.rate, settle, 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if used.Kind != tt.used {
+				t.Errorf("priced to %s, want %s", used.Kind, tt.used)
+			}
+			for _, r := range all {
+				if *r.Price < *used.Price {
+					t.Errorf("price to %s %v is below the price to worst %v", r.Kind, *r.Price, *used.Price)
+				}
+			}
+			// el precio usado rinde rate hasta ese rescate
+			if y, err, _ := Yield(flow, *used.Price, settle, 0, 0); err != nil || math.Abs(y-tt.rate) > 1e-6 {
+				t.Errorf("yield of the flow used %v, %v, want %v", y, err, tt.rate)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+
+	_ "github.com/lib/pq" // PostgreSQL driver
+)
+
+// Arma el connection string de Postgres a partir de las variables POSTGRES_*.
+func postgresConnString() string {
+	return fmt.Sprintf(
+		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		os.Getenv("POSTGRES_HOST"),
+		os.Getenv("POSTGRES_PORT"),
+		os.Getenv("POSTGRES_USER"),
+		os.Getenv("POSTGRES_PASSWORD"),
+		os.Getenv("POSTGRES_DB"),
+	)
+}
+
+// Abre una conexión a Postgres usando las variables POSTGRES_*.
+func openPostgres() (*sql.DB, error) {
+	return sql.Open("postgres", postgresConnString())
+}
+
+// pgPool is a pool opened, and its tables created with ddl, on the first call that reaches the database, and then
+// reused by every call. If opening it fails the next call tries again.
+type pgPool struct {
+	ddl []string
+	mu  sync.Mutex
+	db  *sql.DB
+}
+
+func (p *pgPool) open(ctx context.Context) (*sql.DB, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.db != nil {
+		return p.db, nil
+	}
+	db, err := openPostgres()
+	if err != nil {
+		return nil, fmt.Errorf("open db: %w", err)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ping db: %w", err)
+	}
+	for _, ddl := range p.ddl {
+		if _, err := db.ExecContext(ctx, ddl); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("create tables: %w", err)
+		}
+	}
+	p.db = db
+	return db, nil
+}
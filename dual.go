@@ -0,0 +1,322 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BondLeg is one of the two references of a dual bond (e.g. fixed rate capitalized vs CER, TAMAR vs fixed).
+// Its Cashflow is per 100 of face value before the index adjustment, on the same dates as the bond's Cashflow.
+type BondLeg struct {
+	Name     string
+	Index    string `json:",omitempty"` // index of the leg (see knownIndex), empty for a nominal leg
+	Offset   int    `json:",omitempty"` // lookback of the index in business days, as in Bond.Offset
+	Cashflow []Flujo
+}
+
+// Límites de la búsqueda del breakeven de un bono dual.
+const (
+	dualBreakevenMax  = 1e6
+	dualBreakevenIter = 200
+)
+
+// isDual reports whether the bond pays the greater of two legs.
+func (b Bond) isDual() bool {
+	return len(b.Legs) > 0
+}
+
+// validateLegs checks the legs of a dual bond: exactly two, known indices and the payment dates of the bond.
+func validateLegs(b Bond) []string {
+	var problems []string
+	if len(b.Legs) != 2 {
+		return []string{fmt.Sprintf("a dual bond needs 2 legs, got %d", len(b.Legs))}
+	}
+	if b.Index != "" {
+		problems = append(problems, "a dual bond sets the Index of each leg, not of the bond")
+	}
+	for i, leg := range b.Legs {
+		name := leg.Name
+		if name == "" {
+			name = fmt.Sprintf("leg #%d", i+1)
+		}
+		if leg.Index != "" && !knownIndex(leg.Index) {
+			problems = append(problems, name+": unknown index "+leg.Index)
+		}
+		if len(leg.Cashflow) != len(b.Cashflow) {
+			problems = append(problems, fmt.Sprintf("%s: %d payments, the bond has %d", name, len(leg.Cashflow), len(b.Cashflow)))
+			continue
+		}
+		for k, cf := range leg.Cashflow {
+			if !time.Time(cf.Date).Equal(time.Time(b.Cashflow[k].Date)) {
+				problems = append(problems, fmt.Sprintf("%s: payment %s is not a payment date of the bond", name, cf.Date.Format(DateFormat)))
+				break
+			}
+		}
+	}
+	return problems
+}
+
+// dualLegOut is the value of a dual bond under one of its legs.
+type dualLegOut struct {
+	Name           string
+	Index          string `json:",omitempty"`
+	ExtendIndex    float64
+	Price          float64 // present value of the leg alone
+	MaturityPayoff float64 // last payment of the leg, index adjusted
+	Extrapolated   bool    // the index had to be extended with ExtendIndex
+}
+
+// dualScenario is a weighted assumption of the growth of the index of each leg.
+type dualScenario struct {
+	Weight       float64
+	ExtendIndex1 float64
+	ExtendIndex2 float64
+	Price        float64
+	Paying       string // leg with the greater payoff at maturity
+}
+
+// dualBreakeven is the growth of the index of one leg (in extendIndex terms) at which both legs are worth the same.
+type dualBreakeven struct {
+	Leg         string
+	ExtendIndex float64
+}
+
+// dualValue is the valuation of a dual bond for one set of index assumptions.
+type dualValue struct {
+	legs   [2]dualLegOut
+	flow   []Flujo // greater of both legs at each payment date
+	price  float64
+	paying string
+	index  int // cashflow index returned by Price
+}
+
+// legFlow projects the payments of a leg in pesos: each amount is adjusted by the leg's index ratio
+// at its (rolled) payment date, extending the series with extendIndex past its last value.
+func (md *marketData) legFlow(b Bond, leg BondLeg, extendIndex float64) ([]Flujo, bool, error) {
+	flow, err := md.cashflow(Bond{Cashflow: leg.Cashflow, Calendar: b.Calendar, Roll: b.Roll})
+	if err != nil {
+		return nil, false, err
+	}
+	if leg.Index == "" {
+		return flow, false, nil
+	}
+	extrapolated := false
+	ref := Bond{Ticker: b.Ticker, IssueDate: b.IssueDate, Index: leg.Index, Offset: leg.Offset}
+	for i := range flow {
+		adj, err := md.indexRatio(ref, time.Time(flow[i].Date), extendIndex)
+		if err != nil {
+			return nil, false, fmt.Errorf("%s leg: %w", leg.Name, err)
+		}
+		flow[i].Amount *= adj.ratio
+		flow[i].Residual *= adj.ratio
+		extrapolated = extrapolated || adj.extrapolated
+	}
+	return flow, extrapolated, nil
+}
+
+// valueDual values a dual bond at rate: each leg alone and the bond, that pays the greater of both legs at each payment date.
+// Only the payments a buyer settling on settlementDate is entitled to are valued (see entitledCashflow).
+func (md *marketData) valueDual(b Bond, settlementDate time.Time, rate float64, initialFee float64, endingFee float64, extendIndex [2]float64) (dualValue, error) {
+	var v dualValue
+	var flows [2][]Flujo
+	for i, leg := range b.Legs {
+		flow, extrapolated, err := md.legFlow(b, leg, extendIndex[i])
+		if err != nil {
+			return v, err
+		}
+		// ambas patas tienen las fechas del bono, así que quedan los mismos pagos en las dos
+		if _, flow, err = md.entitlement(b, flow, settlementDate); err != nil {
+			return v, err
+		}
+		if len(flow) == 0 {
+			return v, fmt.Errorf("%s leg: no payments left for a buyer settling on %s", leg.Name, settlementDate.Format(DateFormat))
+		}
+		p, err, _ := Price(flow, rate, settlementDate, initialFee, endingFee)
+		if err != nil {
+			return v, fmt.Errorf("%s leg: %w", leg.Name, err)
+		}
+		flows[i] = flow
+		v.legs[i] = dualLegOut{
+			Name:           leg.Name,
+			Index:          leg.Index,
+			ExtendIndex:    extendIndex[i],
+			Price:          p,
+			MaturityPayoff: flow[len(flow)-1].Amount,
+			Extrapolated:   extrapolated,
+		}
+	}
+
+	v.flow = make([]Flujo, len(flows[0]))
+	for k := range v.flow {
+		v.flow[k] = flows[0][k]
+		if flows[1][k].Amount > flows[0][k].Amount {
+			v.flow[k] = flows[1][k]
+		}
+	}
+	v.paying = v.legs[0].Name
+	if v.legs[1].MaturityPayoff > v.legs[0].MaturityPayoff {
+		v.paying = v.legs[1].Name
+	}
+	var err error
+	if v.price, err, v.index = Price(v.flow, rate, settlementDate, initialFee, endingFee); err != nil {
+		return v, err
+	}
+	return v, nil
+}
+
+// dualBreakevenOf looks for the growth of the index of the indexed leg (the second one if both are)
+// at which both legs are worth the same at rate. It returns nil when the legs don't cross.
+func (md *marketData) dualBreakevenOf(b Bond, settlementDate time.Time, rate float64, initialFee float64, endingFee float64, extendIndex [2]float64) (*dualBreakeven, error) {
+	k := 1
+	if b.Legs[1].Index == "" {
+		k = 0
+	}
+	if b.Legs[k].Index == "" {
+		return nil, nil
+	}
+	diff := func(g float64) (float64, error) {
+		ext := extendIndex
+		ext[k] = g
+		v, err := md.valueDual(b, settlementDate, rate, initialFee, endingFee, ext)
+		if err != nil {
+			return 0, err
+		}
+		return v.legs[k].Price - v.legs[1-k].Price, nil
+	}
+
+	lo, hi := 0.0, 1.0
+	fLo, err := diff(lo)
+	if err != nil {
+		return nil, err
+	}
+	fHi, err := diff(hi)
+	if err != nil {
+		return nil, err
+	}
+	for fLo*fHi > 0 && hi < dualBreakevenMax {
+		hi *= 2
+		if fHi, err = diff(hi); err != nil {
+			return nil, err
+		}
+	}
+	if fLo*fHi > 0 {
+		return nil, nil
+	}
+	for i := 0; i < dualBreakevenIter && hi-lo > 1e-10; i++ {
+		mid := (lo + hi) / 2
+		fMid, err := diff(mid)
+		if err != nil {
+			return nil, err
+		}
+		if fLo*fMid <= 0 {
+			hi = mid
+		} else {
+			lo, fLo = mid, fMid
+		}
+	}
+	return &dualBreakeven{Leg: b.Legs[k].Name, ExtendIndex: (lo + hi) / 2}, nil
+}
+
+// dualExtendFromQuery reads the growth assumption of each leg: extendIndex1 and extendIndex2, defaulting to extendIndex.
+func dualExtendFromQuery(c *gin.Context, extendIndex float64) ([2]float64, error) {
+	ext := [2]float64{extendIndex, extendIndex}
+	for i := range ext {
+		param := "extendIndex" + strconv.Itoa(i+1)
+		if s := c.Query(param); s != "" {
+			v, err := strconv.ParseFloat(s, 64)
+			if err != nil || v < 0 {
+				return ext, fmt.Errorf("%s should be a number greater or equal to 0", param)
+			}
+			ext[i] = v
+		}
+	}
+	return ext, nil
+}
+
+// dualScenariosFromQuery parses the scenario params, each one "weight,extendIndex1,extendIndex2".
+func dualScenariosFromQuery(c *gin.Context) ([]dualScenario, error) {
+	var out []dualScenario
+	for _, s := range c.QueryArray("scenario") {
+		parts := strings.Split(s, ",")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid scenario %q, use weight,extendIndex1,extendIndex2", s)
+		}
+		var v [3]float64
+		for i, p := range parts {
+			f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+			if err != nil || f < 0 || math.IsInf(f, 0) {
+				return nil, fmt.Errorf("invalid scenario %q, use weight,extendIndex1,extendIndex2", s)
+			}
+			v[i] = f
+		}
+		out = append(out, dualScenario{Weight: v[0], ExtendIndex1: v[1], ExtendIndex2: v[2]})
+	}
+	return out, nil
+}
+
+// priceDual answers /price for a dual bond: the price under each leg, the price of the bond
+// (greater of both legs) and, if scenario params are given, the scenario-weighted price.
+func priceDual(c *gin.Context, b Bond, md *marketData, settlementDate time.Time, rate float64, initialFee float64, endingFee float64, extendIndex float64) {
+	ext, err := dualExtendFromQuery(c, extendIndex)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	scenarios, err := dualScenariosFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	v, err := md.valueDual(b, settlementDate, rate, initialFee, endingFee, ext)
+	if err != nil {
+		c.JSON(indexErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	mduration, err := Mduration(v.flow, rate, settlementDate, initialFee, endingFee, v.price)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "sth went wrong with the Mduration calculation"})
+		return
+	}
+	breakeven, err := md.dualBreakevenOf(b, settlementDate, rate, initialFee, endingFee, ext)
+	if err != nil {
+		c.JSON(indexErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	out := gin.H{
+		"Price":      v.price,
+		"MDuration":  mduration,
+		"Legs":       v.legs,
+		"Paying":     v.paying,
+		"Breakeven":  breakeven,
+		"Maturity":   b.Maturity,
+		"MarketData": md,
+	}
+	if len(scenarios) > 0 {
+		total, weighted := 0.0, 0.0
+		for i, s := range scenarios {
+			sv, err := md.valueDual(b, settlementDate, rate, initialFee, endingFee, [2]float64{s.ExtendIndex1, s.ExtendIndex2})
+			if err != nil {
+				c.JSON(indexErrorStatus(err), gin.H{"error": err.Error()})
+				return
+			}
+			scenarios[i].Price, scenarios[i].Paying = sv.price, sv.paying
+			total += s.Weight
+			weighted += s.Weight * sv.price
+		}
+		if total == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the weights of the scenarios add up to 0"})
+			return
+		}
+		out["Scenarios"] = scenarios
+		out["ScenarioWeightedPrice"] = weighted / total
+	}
+	c.JSON(http.StatusOK, out)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// dualBond pays the greater of a fixed leg with coupon and a CER leg with 1% coupons, every six months.
+func dualBond(coupon float64) Bond {
+	dates := []string{"2024-07-01", "2025-01-02", "2025-07-01"}
+	b := Bond{ID: "D1", Ticker: "TDX", IssueDate: Fecha(mustDate("2024-01-02")), Maturity: Fecha(mustDate("2025-07-01")), Currency: "ARS", Issuer: "sovereign"}
+	fixed := BondLeg{Name: "fixed"}
+	cer := BondLeg{Name: "CER", Index: "CER"}
+	for i, d := range dates {
+		cf := Flujo{Date: Fecha(mustDate(d)), Residual: 100}
+		if i == len(dates)-1 {
+			cf.Amort, cf.Residual = 100, 0
+		}
+		b.Cashflow = append(b.Cashflow, cf)
+		cf.Amount = cf.Amort + coupon
+		fixed.Cashflow = append(fixed.Cashflow, cf)
+		cf.Amount = cf.Amort + 1
+		cer.Cashflow = append(cer.Cashflow, cf)
+	}
+	b.Legs = []BondLeg{fixed, cer}
+	return b
+}
+
+func dualMarket(t *testing.T) *marketData {
+	t.Helper()
+	series, err := newIndexSeries("CER", dailyCER("2023-12-01", "2024-06-30"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &marketData{indices: map[string]*IndexSeries{"CER": series}, calendars: buildCalendars(nil), gapPolicy: GapError}
+}
+
+func TestValueDual(t *testing.T) {
+	md := dualMarket(t)
+	b := dualBond(5)
+	settle := mustDate("2024-05-15")
+	v, err := md.valueDual(b, settle, 0.3, 0, 0, [2]float64{0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var legs [2][]Flujo
+	for i, leg := range b.Legs {
+		if legs[i], _, err = md.legFlow(b, leg, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(v.flow) != 3 {
+		t.Fatalf("%d payments, want 3", len(v.flow))
+	}
+	for k, cf := range v.flow {
+		if want := math.Max(legs[0][k].Amount, legs[1][k].Amount); cf.Amount != want {
+			t.Errorf("payment %d: %v, want the greater of %v and %v", k, cf.Amount, legs[0][k].Amount, legs[1][k].Amount)
+		}
+	}
+	// el CER ajustado supera al 5% fijo solo en el pago final
+	if v.flow[0].Amount != 5 || v.flow[2].Amount <= 105 || v.paying != "CER" {
+		t.Errorf("flow %v paying %s", v.flow, v.paying)
+	}
+	if v.price < v.legs[0].Price || v.price < v.legs[1].Price {
+		t.Errorf("price %v is below a leg: %v %v", v.price, v.legs[0].Price, v.legs[1].Price)
+	}
+
+	// ex-cupón: liquidando dentro de los 3 días hábiles antes del pago de julio, ese pago es del vendedor
+	b.RecordDays = 3
+	ex, err := md.valueDual(b, mustDate("2024-06-27"), 0.3, 0, 0, [2]float64{0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cum, err := md.valueDual(b, mustDate("2024-06-25"), 0.3, 0, 0, [2]float64{0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ex.flow) != 2 || len(cum.flow) != 3 {
+		t.Errorf("%d payments ex-coupon and %d cum-coupon, want 2 and 3", len(ex.flow), len(cum.flow))
+	}
+	if ex.legs[0].Price >= cum.legs[0].Price-4 {
+		t.Errorf("fixed leg ex-coupon %v, cum-coupon %v: the coupon is still valued", ex.legs[0].Price, cum.legs[0].Price)
+	}
+	if _, err := md.valueDual(b, mustDate("2025-06-30"), 0.3, 0, 0, [2]float64{0, 0}); err == nil {
+		t.Error("settling after the last record date: want an error")
+	}
+}
+
+func TestDualBreakeven(t *testing.T) {
+	md := dualMarket(t)
+	settle := mustDate("2024-05-15")
+	tests := []struct {
+		name    string
+		coupon  float64
+		crosses bool
+	}{
+		// con el 15% fijo la pata CER necesita que el índice siga creciendo para igualarla
+		{"fixed leg ahead", 15, true},
+		// la pata CER ya vale más sin crecimiento y crece con él: no se cruzan
+		{"CER leg ahead", 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := dualBond(tt.coupon)
+			be, err := md.dualBreakevenOf(b, settle, 0.3, 0, 0, [2]float64{0, 0})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.crosses {
+				if be != nil {
+					t.Errorf("breakeven %+v, want none", *be)
+				}
+				return
+			}
+			if be == nil {
+				t.Fatal("no breakeven")
+			}
+			if be.Leg != "CER" || be.ExtendIndex <= 0 {
+				t.Errorf("breakeven %+v", *be)
+			}
+			v, err := md.valueDual(b, settle, 0.3, 0, 0, [2]float64{0, be.ExtendIndex})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(v.legs[0].Price-v.legs[1].Price) > 1e-6 {
+				t.Errorf("legs at the breakeven: %v and %v", v.legs[0].Price, v.legs[1].Price)
+			}
+		})
+	}
+}
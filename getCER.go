@@ -2,120 +2,158 @@ package main
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
-	"math"
 	"os"
+	"strings"
+	"sync"
 	"time"
-
-	_ "github.com/lib/pq" // PostgreSQL driver
 )
 
-// Global variable to hold CER data
-var Coef []CER
-
-// Struct to hold the index (CER) to adjust the face value of indexed bonds.
+// Struct to hold one value of an index (CER, UVA) to adjust the face value of indexed bonds.
+// The loaded series is kept in an IndexSeries, see currentIndex.
 type CER struct {
 	Date time.Time
 	CER  float64
 }
 
-// Reintenta cargar el CER hasta éxito, con espera 'interval' entre intentos.
+// Indices bonds can be adjusted by (Bond.Index). Each one is read from its own source (<NAME>_SOURCE, see newIndexSource),
+// refreshed by its own job, reported as a dependency in /readyz and snapshotted under its name.
+var indexNames = []string{"CER", "UVA"}
+
+// indexInUse reports whether the index has to be loaded: the CER always, any other one (UVA) only if its source is
+// configured with <NAME>_SOURCE or a loaded bond is adjusted by it. An index not in use doesn't degrade /readyz.
+func indexInUse(name string) bool {
+	if name == depCER || os.Getenv(name+"_SOURCE") != "" {
+		return true
+	}
+	for _, b := range currentBonds() {
+		if strings.EqualFold(b.Index, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Índices con una carga con reintentos en curso, para no lanzar dos a la vez.
+var (
+	indexLoadsMu sync.Mutex
+	indexLoads   = map[string]bool{}
+)
+
+// Context de las cargas con reintentos que lanza startIndexLoads; cancelarlo corta los reintentos.
+var indexLoadContext = context.Background()
+
+// startIndexLoads loads in the background, with LoadIndexWithRetry, every index in use that is not loaded yet.
+// It is called at startup and after the bonds change, since a new bond can start using an index.
+func startIndexLoads(interval time.Duration) {
+	indexLoadsMu.Lock()
+	defer indexLoadsMu.Unlock()
+	for _, name := range indexNames {
+		if indexLoads[name] || dependencyReady(name) || !indexInUse(name) {
+			continue
+		}
+		indexLoads[name] = true
+		go func(name string) {
+			LoadIndexWithRetry(indexLoadContext, name, interval)
+			indexLoadsMu.Lock()
+			delete(indexLoads, name)
+			indexLoadsMu.Unlock()
+		}(name)
+	}
+}
+
+// Reintenta cargar el índice hasta éxito, con espera 'interval' entre intentos.
 // Se puede cancelar pasando un context con cancel.
-func LoadCERWithRetry(ctx context.Context, interval time.Duration) {
+func LoadIndexWithRetry(ctx context.Context, name string, interval time.Duration) {
 	for {
-		if err := getCER(); err == nil {
-			fmt.Println("CER loaded successfully")
+		err := loadIndex(ctx, name)
+		markDependency(name, currentIndex(name).Len(), err)
+		if err == nil {
+			fmt.Println(name, "loaded successfully")
 			return
 		} else {
-			fmt.Println("Error loading CER, retry in", interval)
+			fmt.Println("Error loading", name+", retry in", interval)
 		}
 		select {
 		case <-time.After(interval):
 		case <-ctx.Done():
-			fmt.Println("CER retry canceled:", ctx.Err())
+			fmt.Println(name, "retry canceled:", ctx.Err())
 			return
 		}
 	}
 }
 
-func getCoefficient(date time.Time, extendIndex float64, coef *[]CER) (float64, error) {
-	for i := len(*coef) - 1; i >= 0; i-- {
-		if (*coef)[i].Date == date {
-			return (*coef)[i].CER, nil
+// Job del scheduler: un único intento de carga del índice. Devuelve la cantidad de valores cargados.
+// Un índice que no se usa no se carga.
+func refreshIndex(name string) func(ctx context.Context) (int, error) {
+	return func(ctx context.Context) (int, error) {
+		if !indexInUse(name) {
+			return 0, nil
 		}
+		err := loadIndex(ctx, name)
+		markDependency(name, currentIndex(name).Len(), err)
+		if err != nil {
+			return 0, err
+		}
+		return currentIndex(name).Len(), nil
 	}
-	// Calculate the difference in days between date variable and the last date in the index.
-	diffDays := date.Sub((*coef)[len(*coef)-1].Date).Hours() / 24
-	newCoef := (*coef)[len(*coef)-1].CER * (math.Pow(1+extendIndex/365, diffDays/365))
+}
+
+// Sources of the indices, built on first use from the environment.
+var (
+	indexSourcesMu sync.Mutex
+	indexSources   = map[string]IndexSource{}
+)
 
-	return newCoef, nil
+func indexSource(name string) (IndexSource, error) {
+	indexSourcesMu.Lock()
+	defer indexSourcesMu.Unlock()
+	if src, ok := indexSources[name]; ok {
+		return src, nil
+	}
+	src, err := newIndexSource(name)
+	if err != nil {
+		return nil, err
+	}
+	indexSources[name] = src
+	return src, nil
 }
 
-func getCER() error {
-	// Connect to PostgreSQL database using environment variables
-	dbUser := os.Getenv("POSTGRES_USER")
-	dbPassword := os.Getenv("POSTGRES_PASSWORD")
-	dbHost := os.Getenv("POSTGRES_HOST")
-	dbPort := os.Getenv("POSTGRES_PORT")
-	dbName := os.Getenv("POSTGRES_DB")
-	fmt.Println("Host: ", dbHost)
-	fmt.Println("Port: ", dbPort)
-	fmt.Println("DB: ", dbName)
-
-	// Connection string for PostgreSQL
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		dbHost, dbPort, dbUser, dbPassword, dbName)
-
-	// Open a connection to the PostgreSQL database
-	db, err := sql.Open("postgres", connStr)
+// loadIndex reads the whole series of the index from its source and replaces the loaded one.
+// ctx bounds the read, so a canceled job or retry stops waiting for the source.
+func loadIndex(ctx context.Context, name string) error {
+	src, err := indexSource(name)
 	if err != nil {
-		fmt.Println("Error opening database:", err)
+		fmt.Println("Error configuring", name, "source:", err)
 		return err
 	}
-	defer db.Close()
+	fmt.Println(name, "source: ", src.Describe())
 
-	// Query the "CER" table
-	rows, err := db.Query(`SELECT date, "CER" FROM "CER"`) // Using escaped quotes for table name
+	obs, err := src.LoadIndex(ctx)
 	if err != nil {
-		fmt.Println("Error querying CER table:", err)
+		fmt.Println("Error loading", name+":", err)
 		return err
 	}
-	defer rows.Close()
 
-	// Clear previous CER data
-	if len(Coef) > 0 {
-		Coef = nil
+	// Dates are normalized to the calendar day and sorted by the series
+	series, err := newIndexSeries(name, obs)
+	if err != nil {
+		fmt.Println("Error loading", name+":", err)
+		return err
 	}
 
-	// Iterate through the query results and populate the Coef global variable
-	for rows.Next() {
-		var dateTimestamp time.Time // Changed to time.Time directly for PostgreSQL
-		var cerValue float64
-
-		// Scan the values from the row
-		if err := rows.Scan(&dateTimestamp, &cerValue); err != nil {
-			fmt.Println("Error scanning row:", err)
-			return err
-		}
-
-		// Convert the date to UTC to strip timezone info
-		dateTimestamp = dateTimestamp.UTC() // Ensure the date is in UTC
-
-		// Create a CER struct and populate its fields
-		var coef CER
-		coef.Date = dateTimestamp // Use date directly from PostgreSQL
-		coef.CER = cerValue
-
-		// Append to the Coef slice
-		Coef = append(Coef, coef)
+	// Replace previous data of the index
+	setIndex(series)
+	if err := snapshots.Save(name, src.Describe(), series.Observations()); err != nil {
+		fmt.Println("Error saving", name, "snapshot:", err)
 	}
 
-	fmt.Println("Total Records in table: ", len(Coef))
+	last := series.Last()
+	fmt.Println("Total Records in table: ", series.Len())
 	fmt.Println()
 	fmt.Println("Last Record in table: ")
-	fmt.Println("Fecha: ", Coef[len(Coef)-1].Date.Format(DateFormat))
-	fmt.Println("CER: ", Coef[len(Coef)-1].CER)
+	fmt.Println("Fecha: ", last.Date.Format(DateFormat))
+	fmt.Println(name+": ", last.CER)
 	fmt.Println()
 
 	return nil
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// useIndexSource makes name load from src and puts back the configured source when the test ends.
+func useIndexSource(t *testing.T, name string, src IndexSource) {
+	t.Helper()
+	indexSourcesMu.Lock()
+	prev, had := indexSources[name]
+	indexSources[name] = src
+	indexSourcesMu.Unlock()
+	t.Cleanup(func() {
+		indexSourcesMu.Lock()
+		defer indexSourcesMu.Unlock()
+		if had {
+			indexSources[name] = prev
+		} else {
+			delete(indexSources, name)
+		}
+	})
+}
+
+// The refresh job stops waiting for a source that doesn't answer when its context ends.
+func TestRefreshIndexHonorsContext(t *testing.T) {
+	setTestMarket(t, nil, nil, nil)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	useIndexSource(t, "CER", &httpIndexSource{url: srv.URL})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := refreshIndex("CER")(ctx); err == nil {
+		t.Fatal("want an error")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("refreshIndex took %s after its context ended", d)
+	}
+}
+
+// fakeIndexSource answers obs or err and counts the loads.
+type fakeIndexSource struct {
+	obs   []CER
+	err   error
+	loads int32
+}
+
+func (s *fakeIndexSource) LoadIndex(ctx context.Context) ([]CER, error) {
+	atomic.AddInt32(&s.loads, 1)
+	return s.obs, s.err
+}
+
+func (s *fakeIndexSource) Describe() string { return "fake" }
+
+// A failed refresh keeps the series loaded before and the index ready.
+func TestFailedRefreshKeepsIndexReady(t *testing.T) {
+	setTestMarket(t, nil, dailyCER("2024-01-01", "2024-01-31"), nil)
+	useIndexSource(t, "CER", &fakeIndexSource{err: errors.New("source down")})
+
+	if _, err := refreshIndex("CER")(context.Background()); err == nil {
+		t.Fatal("want an error")
+	}
+	if !dependencyReady(depCER) || currentIndex("CER").Len() != 31 {
+		t.Errorf("after a failed refresh: ready %v with %d values, want the 31 loaded before", dependencyReady(depCER), currentIndex("CER").Len())
+	}
+}
+
+// waitIndexLoads waits for the loads started by startIndexLoads to end.
+func waitIndexLoads(t *testing.T) {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(time.Millisecond) {
+		indexLoadsMu.Lock()
+		n := len(indexLoads)
+		indexLoadsMu.Unlock()
+		if n == 0 {
+			return
+		}
+	}
+	t.Fatal("the index loads didn't end")
+}
+
+func TestStartIndexLoads(t *testing.T) {
+	t.Setenv("UVA_SOURCE", "")
+	uvaBond := cerBond
+	uvaBond.Ticker, uvaBond.Index = "UVA1", "UVA"
+	tests := []struct {
+		name      string
+		bonds     []Bond
+		uvaReady  bool
+		source    *fakeIndexSource
+		wantLoads int32
+		wantReady bool
+	}{
+		{"unused index is not loaded", []Bond{cerBond}, false, &fakeIndexSource{obs: dailyCER("2024-01-01", "2024-01-31")}, 0, false},
+		{"index in use is loaded", []Bond{uvaBond}, false, &fakeIndexSource{obs: dailyCER("2024-01-01", "2024-01-31")}, 1, true},
+		{"a failed load of an index not loaded yet", []Bond{uvaBond}, false, &fakeIndexSource{err: errors.New("source down")}, 1, false},
+		// recargar los bonos no vuelve a cargar un índice listo, aunque su fuente falle ahora
+		{"ready index is kept", []Bond{uvaBond}, true, &fakeIndexSource{err: errors.New("source down")}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestMarket(t, tt.bonds, dailyCER("2024-01-01", "2024-01-31"), nil)
+			depsMu.Lock()
+			deps[depUVA] = &depStatus{Name: depUVA}
+			depsMu.Unlock()
+			if tt.uvaReady {
+				markDependency(depUVA, 31, nil)
+			}
+			useIndexSource(t, "UVA", tt.source)
+			cerSource := &fakeIndexSource{err: errors.New("source down")}
+			useIndexSource(t, "CER", cerSource)
+
+			// el retry se corta enseguida: el primer intento es el que cuenta
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			prev := indexLoadContext
+			indexLoadContext = ctx
+			defer func() { indexLoadContext = prev }()
+
+			startIndexLoads(time.Hour)
+			waitIndexLoads(t)
+			if got := atomic.LoadInt32(&tt.source.loads); got != tt.wantLoads {
+				t.Errorf("UVA loaded %d times, want %d", got, tt.wantLoads)
+			}
+			if atomic.LoadInt32(&cerSource.loads) != 0 {
+				t.Error("the CER, ready, was loaded again")
+			}
+			if dependencyReady(depUVA) != tt.wantReady {
+				t.Errorf("UVA ready %v, want %v", dependencyReady(depUVA), tt.wantReady)
+			}
+		})
+	}
+}
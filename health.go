@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Names of the data dependencies reported by /readyz.
+const (
+	depBonds    = "bonds"
+	depCER      = "CER"
+	depUVA      = "UVA"
+	depHolidays = "holidays"
+)
+
+// depStatus is the state of one data dependency of the service.
+type depStatus struct {
+	Name        string
+	Required    bool // the service is not ready without it
+	Ready       bool
+	Unused      bool `json:",omitempty"` // an index no bond uses and without a source configured, see indexInUse
+	Rows        int
+	LastAttempt *time.Time `json:",omitempty"`
+	LastSuccess *time.Time `json:",omitempty"`
+	LastError   string     `json:",omitempty"`
+}
+
+var (
+	startedAt = time.Now()
+	depsMu    sync.RWMutex
+	deps      = map[string]*depStatus{
+		depBonds:    {Name: depBonds, Required: true},
+		depCER:      {Name: depCER},
+		depUVA:      {Name: depUVA},
+		depHolidays: {Name: depHolidays},
+	}
+)
+
+// markDependency records the result of a load attempt. A failed reload keeps the dependency
+// ready if a previous load succeeded, since the data loaded before is still being served.
+func markDependency(name string, rows int, err error) {
+	depsMu.Lock()
+	defer depsMu.Unlock()
+	d, ok := deps[name]
+	if !ok {
+		d = &depStatus{Name: name}
+		deps[name] = d
+	}
+	now := time.Now()
+	d.LastAttempt = &now
+	if err != nil {
+		d.LastError = err.Error()
+		return
+	}
+	d.Ready = true
+	d.Rows = rows
+	d.LastSuccess = &now
+	d.LastError = ""
+}
+
+func dependencyReady(name string) bool {
+	depsMu.RLock()
+	defer depsMu.RUnlock()
+	d, ok := deps[name]
+	return ok && d.Ready
+}
+
+func dependencies() []depStatus {
+	depsMu.RLock()
+	out := make([]depStatus, 0, len(deps))
+	for _, d := range deps {
+		out = append(out, *d)
+	}
+	depsMu.RUnlock()
+	for i := range out {
+		if knownIndex(out[i].Name) && !out[i].Ready {
+			out[i].Unused = !indexInUse(out[i].Name)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// indexUnavailable returns an error if an indexed bond can't be valued yet because
+// its index or the holidays used to apply the offset are not loaded.
+func indexUnavailable(index string) error {
+	if !dependencyReady(index) {
+		return fmt.Errorf("%s index not loaded yet, try again later", index)
+	}
+	if !dependencyReady(depHolidays) {
+		return fmt.Errorf("holidays not loaded yet, %s offsets can't be computed", index)
+	}
+	return nil
+}
+
+// healthzWrapper answers as long as the process is up.
+func healthzWrapper(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": "ok",
+		"uptime": time.Since(startedAt).Round(time.Second).String(),
+	})
+}
+
+// readyzWrapper reports every data dependency. It returns 503 while a required one is missing
+// and "degraded" while an optional one is missing (e.g. CER: only non-indexed bonds can be valued).
+func readyzWrapper(c *gin.Context) {
+	status := "ready"
+	code := http.StatusOK
+	list := dependencies()
+	for _, d := range list {
+		if d.Ready || d.Unused {
+			continue
+		}
+		if d.Required {
+			status = "not ready"
+			code = http.StatusServiceUnavailable
+			break
+		}
+		status = "degraded"
+	}
+	c.JSON(code, gin.H{
+		"status":       status,
+		"dependencies": list,
+	})
+}
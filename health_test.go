@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// A failed load records the error but keeps a dependency that was loaded before ready, with its rows.
+func TestMarkDependency(t *testing.T) {
+	setTestMarket(t, nil, nil, nil)
+	failed := errors.New("source down")
+	steps := []struct {
+		name  string
+		rows  int
+		err   error
+		ready bool
+		want  int // rows after the step
+	}{
+		{"never loaded fails", 0, failed, false, 0},
+		{"loads", 120, nil, true, 120},
+		{"reload fails", 0, failed, true, 120},
+		{"reloads", 130, nil, true, 130},
+	}
+	for _, st := range steps {
+		markDependency("TEST", st.rows, st.err)
+		var d depStatus
+		for _, dep := range dependencies() {
+			if dep.Name == "TEST" {
+				d = dep
+			}
+		}
+		if d.Ready != st.ready || d.Rows != st.want || dependencyReady("TEST") != st.ready {
+			t.Errorf("%s: ready %v rows %d, want %v %d", st.name, d.Ready, d.Rows, st.ready, st.want)
+		}
+		if (d.LastError != "") != (st.err != nil) || d.LastAttempt == nil {
+			t.Errorf("%s: last error %q, last attempt %v", st.name, d.LastError, d.LastAttempt)
+		}
+		if st.ready && d.LastSuccess == nil {
+			t.Errorf("%s: no last success", st.name)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// indexValueOut is one value of an index as returned by the index endpoints.
+type indexValueOut struct {
+	Date  Fecha
+	Value float64
+}
+
+// indexHistoryWrapper returns the values of an index between from and to inclusive, as json or csv (format=csv).
+func indexHistoryWrapper(c *gin.Context) {
+	name := strings.ToUpper(c.Param("name"))
+	md, err := marketDataForRequest(c)
+	if err != nil {
+		c.JSON(indexErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	series, err := md.indexSeries(name)
+	if err != nil {
+		c.JSON(indexSeriesErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	from := series.First().Date
+	to := series.Last().Date
+	if s := c.Query("from"); s != "" {
+		if from, err = time.Parse(DateFormat, s); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from date"})
+			return
+		}
+	}
+	if s := c.Query("to"); s != "" {
+		if to, err = time.Parse(DateFormat, s); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to date"})
+			return
+		}
+	}
+
+	values := []indexValueOut{}
+	for _, v := range series.Values(from, to) {
+		values = append(values, indexValueOut{Date: Fecha(v.Date), Value: v.CER})
+	}
+
+	if strings.EqualFold(c.Query("format"), "csv") {
+		var buffer bytes.Buffer
+		writer := csv.NewWriter(&buffer)
+		writer.Write([]string{"date", strings.ToLower(name)})
+		for _, v := range values {
+			writer.Write([]string{v.Date.Format(DateFormat), strconv.FormatFloat(v.Value, 'f', -1, 64)})
+		}
+		writer.Flush()
+		c.Header("Content-Disposition", fmt.Sprintf("attachment;filename=%s.csv", name))
+		c.Data(http.StatusOK, "text/csv", buffer.Bytes())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"Index":      name,
+		"From":       Fecha(from),
+		"To":         Fecha(to),
+		"Values":     values,
+		"MarketData": md,
+	})
+}
+
+// indexLookupWrapper returns the value of an index the service uses for date: the date is moved
+// the bond's Offset business days (or offset, if no ticker is given) and the value is looked up,
+// extending the series with extendIndex past its last value.
+func indexLookupWrapper(c *gin.Context) {
+	name := strings.ToUpper(c.Param("name"))
+	date, err := time.Parse(DateFormat, c.Query("date"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid date"})
+		return
+	}
+	extendIndex := 0.0
+	if s := c.Query("extendIndex"); s != "" {
+		if extendIndex, err = strconv.ParseFloat(s, 64); err != nil || extendIndex < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "extendIndex should be a number greater or equal to 0"})
+			return
+		}
+	}
+	offset := 0
+	ticker := strings.ToUpper(c.Query("ticker"))
+	if ticker != "" {
+		bonds, err := bondsForRequest(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		_, index, err := getCashFlow(bonds, ticker)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "ticker not found"})
+			return
+		}
+		if !strings.EqualFold(bonds[index].Index, name) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": ticker + " is not adjusted by " + name})
+			return
+		}
+		offset = bonds[index].Offset
+	} else if s := c.Query("offset"); s != "" {
+		if offset, err = strconv.Atoi(s); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid offset"})
+			return
+		}
+	}
+
+	md, err := marketDataForRequest(c)
+	if err != nil {
+		c.JSON(indexErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	series, err := md.indexSeries(name)
+	if err != nil {
+		c.JSON(indexSeriesErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	coefDate := md.calendars[CalendarAR].WorkdaysFrom(date, offset)
+	value, err := series.Lookup(coefDate, extendIndex, md.gapPolicy)
+	if err != nil {
+		c.JSON(indexErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	last := series.Last()
+	c.JSON(http.StatusOK, gin.H{
+		"Index":        name,
+		"Ticker":       ticker,
+		"Date":         Fecha(date),
+		"Offset":       offset,
+		"CoefDate":     Fecha(coefDate),
+		"Value":        value.Value,
+		"Status":       value.Status,
+		"Extrapolated": value.Extrapolated,
+		"ExtendIndex":  extendIndex,
+		"GapPolicy":    md.gapPolicy,
+		"LastValue":    indexValueOut{Date: Fecha(last.Date), Value: last.CER},
+		"MarketData":   md,
+	})
+}
+
+// indexSeriesErrorStatus is the http status for an error of marketData.indexSeries.
+func indexSeriesErrorStatus(err error) int {
+	if errors.Is(err, errDataUnavailable) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusNotFound
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How a value is obtained for a date inside the series that has no published value.
+const (
+	GapError       = "error"       // the date can't be valued
+	GapCarry       = "carry"       // last published value before the date
+	GapInterpolate = "interpolate" // geometric interpolation between the published values around the date
+)
+
+// Status of a looked up value.
+const (
+	StatusPublished    = "published"
+	StatusCarried      = "carried"
+	StatusInterpolated = "interpolated"
+	StatusExtrapolated = "extrapolated" // after the last value, extended with extendIndex
+)
+
+var (
+	errIndexGap        = errors.New("no published value for that date")
+	errBeforeFirstDate = errors.New("date is before the first value of the index")
+)
+
+// IndexSeries is an index (CER, ...) keyed by date. Dates are normalized to midnight UTC and sorted,
+// so lookups are exact by calendar day and O(log n). A series is never modified once built.
+type IndexSeries struct {
+	Name   string
+	dates  []time.Time
+	values []float64
+}
+
+// indexLookup is the value of an index for a date and how it was obtained.
+type indexLookup struct {
+	Date         time.Time
+	Value        float64
+	Status       string
+	Extrapolated bool
+}
+
+// normalizeDate strips the time of day, time zone and monotonic reading of t, keeping its calendar day.
+func normalizeDate(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// newIndexSeries builds a series from observations in any order. If a date is repeated the last observation wins.
+func newIndexSeries(name string, obs []CER) (*IndexSeries, error) {
+	if len(obs) == 0 {
+		return nil, fmt.Errorf("%s: no values", name)
+	}
+	sorted := make([]CER, len(obs))
+	copy(sorted, obs)
+	for i := range sorted {
+		sorted[i].Date = normalizeDate(sorted[i].Date)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Date.Before(sorted[j].Date) })
+
+	s := &IndexSeries{Name: name}
+	for _, o := range sorted {
+		if o.CER <= 0 || math.IsNaN(o.CER) || math.IsInf(o.CER, 0) {
+			return nil, fmt.Errorf("%s: invalid value %v on %s", name, o.CER, o.Date.Format(DateFormat))
+		}
+		if n := len(s.dates); n > 0 && s.dates[n-1].Equal(o.Date) {
+			s.values[n-1] = o.CER
+			continue
+		}
+		s.dates = append(s.dates, o.Date)
+		s.values = append(s.values, o.CER)
+	}
+	return s, nil
+}
+
+func (s *IndexSeries) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.dates)
+}
+
+// First and Last return the first and last published values.
+func (s *IndexSeries) First() CER {
+	return CER{Date: s.dates[0], CER: s.values[0]}
+}
+
+func (s *IndexSeries) Last() CER {
+	n := len(s.dates) - 1
+	return CER{Date: s.dates[n], CER: s.values[n]}
+}
+
+// Values returns the published values between from and to inclusive.
+func (s *IndexSeries) Values(from time.Time, to time.Time) []CER {
+	from, to = normalizeDate(from), normalizeDate(to)
+	i := sort.Search(len(s.dates), func(i int) bool { return !s.dates[i].Before(from) })
+	out := []CER{}
+	for ; i < len(s.dates) && !s.dates[i].After(to); i++ {
+		out = append(out, CER{Date: s.dates[i], CER: s.values[i]})
+	}
+	return out
+}
+
+// Observations returns every published value, e.g. to snapshot the series.
+func (s *IndexSeries) Observations() []CER {
+	return s.Values(s.dates[0], s.dates[len(s.dates)-1])
+}
+
+// Lookup returns the value for date. After the last value the series is extended at the annual rate
+// extendIndex; inside the series a date without a published value is resolved with gapPolicy;
+// before the first value it is an error.
+func (s *IndexSeries) Lookup(date time.Time, extendIndex float64, gapPolicy string) (indexLookup, error) {
+	date = normalizeDate(date)
+	out := indexLookup{Date: date}
+	if s.Len() == 0 {
+		return out, fmt.Errorf("%w: index not loaded", errDataUnavailable)
+	}
+	i := sort.Search(len(s.dates), func(i int) bool { return !s.dates[i].Before(date) })
+	switch {
+	case i < len(s.dates) && s.dates[i].Equal(date):
+		out.Value, out.Status = s.values[i], StatusPublished
+	case i == len(s.dates):
+		// Calculate the difference in days between date variable and the last date in the index.
+		last := s.Last()
+		diffDays := date.Sub(last.Date).Hours() / 24
+		out.Value = last.CER * (math.Pow(1+extendIndex/365, diffDays/365))
+		out.Status, out.Extrapolated = StatusExtrapolated, true
+	case i == 0:
+		return out, fmt.Errorf("%s %s: %w (%s)", s.Name, date.Format(DateFormat), errBeforeFirstDate, s.dates[0].Format(DateFormat))
+	default:
+		prevDate, prev := s.dates[i-1], s.values[i-1]
+		nextDate, next := s.dates[i], s.values[i]
+		switch gapPolicy {
+		case GapCarry:
+			out.Value, out.Status = prev, StatusCarried
+		case GapInterpolate:
+			w := date.Sub(prevDate).Hours() / nextDate.Sub(prevDate).Hours()
+			out.Value, out.Status = prev*math.Pow(next/prev, w), StatusInterpolated
+		default:
+			return out, fmt.Errorf("%s %s: %w (between %s and %s)", s.Name, date.Format(DateFormat), errIndexGap,
+				prevDate.Format(DateFormat), nextDate.Format(DateFormat))
+		}
+	}
+	return out, nil
+}
+
+// normalizeGapPolicy maps a gap policy param to one of the Gap constants. Empty means the INDEX_GAP_POLICY default.
+func normalizeGapPolicy(policy string) (string, error) {
+	if policy == "" {
+		policy = os.Getenv("INDEX_GAP_POLICY")
+	}
+	switch strings.ToLower(strings.TrimSpace(policy)) {
+	case "", GapError:
+		return GapError, nil
+	case GapCarry, "carry-forward", "carryforward":
+		return GapCarry, nil
+	case GapInterpolate, "interpolation":
+		return GapInterpolate, nil
+	}
+	return "", fmt.Errorf("unknown gap policy %q, use error, carry or interpolate", policy)
+}
+
+// Índices cargados, por nombre. Cada carga reemplaza la serie entera.
+var (
+	indicesMu sync.RWMutex
+	indices   = map[string]*IndexSeries{}
+)
+
+func currentIndex(name string) *IndexSeries {
+	indicesMu.RLock()
+	defer indicesMu.RUnlock()
+	return indices[name]
+}
+
+func setIndex(s *IndexSeries) {
+	indicesMu.Lock()
+	indices[s.Name] = s
+	indicesMu.Unlock()
+}
+
+func currentIndices() map[string]*IndexSeries {
+	indicesMu.RLock()
+	defer indicesMu.RUnlock()
+	out := make(map[string]*IndexSeries, len(indices))
+	for k, v := range indices {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// gappedSeries has no values on the weekend of 2024-06-08 and from 2024-06-12 to 2024-06-13.
+var gappedSeries = []CER{
+	{Date: mustDate("2024-06-14"), CER: 110},
+	{Date: mustDate("2024-06-07"), CER: 100},
+	{Date: mustDate("2024-06-10"), CER: 103},
+	{Date: mustDate("2024-06-11"), CER: 104},
+}
+
+func TestNewIndexSeries(t *testing.T) {
+	tests := []struct {
+		name    string
+		obs     []CER
+		want    []float64 // values sorted by date
+		wantErr bool
+	}{
+		{"sorted by date", gappedSeries, []float64{100, 103, 104, 110}, false},
+		{"the last repeated date wins", []CER{{mustDate("2024-06-07"), 1}, {mustDate("2024-06-07").Add(15 * time.Hour), 2}}, []float64{2}, false},
+		{"empty", nil, nil, true},
+		{"zero", []CER{{mustDate("2024-06-07"), 0}}, nil, true},
+		{"NaN", []CER{{mustDate("2024-06-07"), math.NaN()}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newIndexSeries("CER", tt.obs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			obs := s.Observations()
+			if len(obs) != len(tt.want) {
+				t.Fatalf("got %d values, want %d", len(obs), len(tt.want))
+			}
+			for i, o := range obs {
+				if o.CER != tt.want[i] || (i > 0 && !o.Date.After(obs[i-1].Date)) {
+					t.Errorf("value %d: %v on %s", i, o.CER, o.Date.Format(DateFormat))
+				}
+			}
+		})
+	}
+}
+
+func TestIndexSeriesLookup(t *testing.T) {
+	s, err := newIndexSeries("CER", gappedSeries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name         string
+		date         time.Time
+		extendIndex  float64
+		gapPolicy    string
+		want         float64
+		status       string
+		extrapolated bool
+		wantErr      error
+	}{
+		{"exact hit", mustDate("2024-06-10"), 0, GapError, 103, StatusPublished, false, nil},
+		{"exact hit with the time of day", mustDate("2024-06-10").Add(18 * time.Hour), 0, GapError, 103, StatusPublished, false, nil},
+		{"first value", mustDate("2024-06-07"), 0, GapError, 100, StatusPublished, false, nil},
+		{"last value is not extrapolated", mustDate("2024-06-14"), 0.5, GapError, 110, StatusPublished, false, nil},
+		{"gap with error", mustDate("2024-06-08"), 0, GapError, 0, "", false, errIndexGap},
+		{"gap carried", mustDate("2024-06-13"), 0, GapCarry, 104, StatusCarried, false, nil},
+		// dos de tres días entre 104 y 110: 104 * (110/104)^(2/3)
+		{"gap interpolated", mustDate("2024-06-13"), 0, GapInterpolate, 104 * math.Pow(110.0/104, 2.0/3), StatusInterpolated, false, nil},
+		{"before the first value", mustDate("2024-06-06"), 0, GapCarry, 0, "", false, errBeforeFirstDate},
+		{"past the last value without extrapolation", mustDate("2024-07-14"), 0, GapError, 110, StatusExtrapolated, true, nil},
+		{"past the last value extrapolated", mustDate("2025-06-14"), 0.365, GapError, 110 * 1.001, StatusExtrapolated, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Lookup(tt.date, tt.extendIndex, tt.gapPolicy)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(got.Value-tt.want) > 1e-9 || got.Status != tt.status || got.Extrapolated != tt.extrapolated {
+				t.Errorf("got %v %s extrapolated %v, want %v %s %v", got.Value, got.Status, got.Extrapolated, tt.want, tt.status, tt.extrapolated)
+			}
+			if !got.Date.Equal(normalizeDate(tt.date)) {
+				t.Errorf("date %s, want the day looked up", got.Date)
+			}
+		})
+	}
+
+	var empty *IndexSeries
+	if _, err := empty.Lookup(mustDate("2024-06-10"), 0, GapError); !errors.Is(err, errDataUnavailable) {
+		t.Errorf("empty series: error %v, want errDataUnavailable", err)
+	}
+}
+
+// indexRatio flags the ratio as extrapolated when the value of the settlement date is past the last published one.
+func TestIndexRatioExtrapolated(t *testing.T) {
+	s, err := newIndexSeries("CER", gappedSeries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := &marketData{indices: map[string]*IndexSeries{"CER": s}, calendars: buildCalendars(nil), gapPolicy: GapCarry}
+	b := Bond{Ticker: "TX", IssueDate: Fecha(mustDate("2024-06-07")), Index: "CER"}
+	tests := []struct {
+		settlement   string
+		ratio        float64
+		extrapolated bool
+	}{
+		{"2024-06-11", 1.04, false},
+		{"2024-06-13", 1.04, false}, // carried
+		{"2024-06-20", 1.10, true},
+	}
+	for _, tt := range tests {
+		adj, err := md.indexRatio(b, mustDate(tt.settlement), 0)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.settlement, err)
+		}
+		if math.Abs(adj.ratio-tt.ratio) > 1e-12 || adj.extrapolated != tt.extrapolated {
+			t.Errorf("%s: ratio %v extrapolated %v, want %v %v", tt.settlement, adj.ratio, adj.extrapolated, tt.ratio, tt.extrapolated)
+		}
+	}
+}
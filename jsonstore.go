@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+)
+
+// jsonFile is a json file read whole and written atomically on every change. Callers hold mu around a read and
+// the write that follows it.
+type jsonFile struct {
+	path string
+	mu   sync.Mutex
+}
+
+// newJSONFile returns the file at the path of envVar, or def if it is not set.
+func newJSONFile(envVar string, def string) *jsonFile {
+	path := os.Getenv(envVar)
+	if path == "" {
+		path = def
+	}
+	return &jsonFile{path: path}
+}
+
+// read decodes the file into out. A missing file leaves out untouched.
+func (f *jsonFile) read(out interface{}) error {
+	data, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("read %s: %w", f.path, err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("parse %s: %w", f.path, err)
+	}
+	return nil
+}
+
+func (f *jsonFile) write(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal %s: %w", f.path, err)
+	}
+	return writeFileAtomic(f.path, data, 0644)
+}
+
+// namedStore keeps a list of records with a unique Name in a jsonFile, sorted by name.
+// The portfolio and scenario stores wrap it with their own types.
+type namedStore struct {
+	file *jsonFile
+}
+
+func newNamedStore(envVar string, def string) *namedStore {
+	return &namedStore{file: newJSONFile(envVar, def)}
+}
+
+// namedRecord is a stored record, kept as json so the store does not need to know its type.
+type namedRecord struct {
+	name string
+	data json.RawMessage
+}
+
+func (s *namedStore) load() ([]namedRecord, error) {
+	var raw []json.RawMessage
+	if err := s.file.read(&raw); err != nil {
+		return nil, err
+	}
+	out := make([]namedRecord, len(raw))
+	for i, data := range raw {
+		var r struct{ Name string }
+		if err := json.Unmarshal(data, &r); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", s.file.path, err)
+		}
+		out[i] = namedRecord{name: r.Name, data: data}
+	}
+	return out, nil
+}
+
+func (s *namedStore) write(list []namedRecord) error {
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+	raw := make([]json.RawMessage, len(list))
+	for i, r := range list {
+		raw[i] = r.data
+	}
+	return s.file.write(raw)
+}
+
+// list decodes every record into out, a pointer to a slice.
+func (s *namedStore) list(out interface{}) error {
+	s.file.mu.Lock()
+	defer s.file.mu.Unlock()
+	return s.file.read(out)
+}
+
+// get decodes the record called name into out, or returns false if there is none.
+func (s *namedStore) get(name string, out interface{}) (bool, error) {
+	s.file.mu.Lock()
+	defer s.file.mu.Unlock()
+	list, err := s.load()
+	if err != nil {
+		return false, err
+	}
+	for _, r := range list {
+		if r.name == name {
+			return true, json.Unmarshal(r.data, out)
+		}
+	}
+	return false, nil
+}
+
+// save adds v as the record called name or replaces the one with the same name.
+func (s *namedStore) save(name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("marshal %s: %w", name, err)
+	}
+	s.file.mu.Lock()
+	defer s.file.mu.Unlock()
+	list, err := s.load()
+	if err != nil {
+		return err
+	}
+	for i := range list {
+		if list[i].name == name {
+			list[i].data = data
+			return s.write(list)
+		}
+	}
+	return s.write(append(list, namedRecord{name: name, data: data}))
+}
+
+// Delete removes the record called name and reports whether it existed.
+func (s *namedStore) Delete(name string) (bool, error) {
+	s.file.mu.Lock()
+	defer s.file.mu.Unlock()
+	list, err := s.load()
+	if err != nil {
+		return false, err
+	}
+	for i := range list {
+		if list[i].name == name {
+			return true, s.write(append(list[:i], list[i+1:]...))
+		}
+	}
+	return false, nil
+}
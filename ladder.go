@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Buckets of the cashflow ladder.
+const (
+	LadderDate    = "date"
+	LadderMonth   = "month"
+	LadderQuarter = "quarter"
+)
+
+// normalizeLadderBucket maps the bucket param to LadderMonth (default), LadderQuarter or LadderDate.
+func normalizeLadderBucket(bucket string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(bucket)) {
+	case "", LadderMonth, "monthly":
+		return LadderMonth, nil
+	case LadderQuarter, "quarterly":
+		return LadderQuarter, nil
+	case LadderDate, "daily", "none":
+		return LadderDate, nil
+	}
+	return "", fmt.Errorf("unknown bucket %q, use month, quarter or date", bucket)
+}
+
+// ladderPeriod returns the name and first day of the bucket of d.
+func ladderPeriod(d time.Time, bucket string) (string, time.Time) {
+	switch bucket {
+	case LadderMonth:
+		return d.Format("2006-01"), time.Date(d.Year(), d.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case LadderQuarter:
+		q := (int(d.Month())-1)/3 + 1
+		return fmt.Sprintf("%d-Q%d", d.Year(), q), time.Date(d.Year(), time.Month(3*(q-1)+1), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return d.Format(DateFormat), d
+}
+
+// ladderFlow is a payment of a position: the bond's cashflow scaled by the nominal and, for indexed bonds,
+// adjusted by the index ratio at the payment date. Amounts are in the currency of the position.
+type ladderFlow struct {
+	Date         Fecha
+	Ticker       string
+	Currency     string
+	Nominal      float64
+	Interest     float64
+	Amortization float64
+	Total        float64
+	Ratio        float64 // index ratio applied, 1 if the bond is not indexed
+	Projected    bool    // the index was extended past its last published value
+}
+
+// ladderRow is the sum of the payments of a bucket in one currency.
+type ladderRow struct {
+	Period       string
+	Start        Fecha
+	Currency     string
+	Interest     float64
+	Amortization float64
+	Total        float64
+	Projected    bool // some payment of the row was projected
+}
+
+// ladderTotal is the sum of the payments in one currency.
+type ladderTotal struct {
+	Interest     float64
+	Amortization float64
+	Total        float64
+	Projected    bool
+}
+
+func (r *ladderRow) add(interest float64, amort float64, projected bool) {
+	r.Interest += interest
+	r.Amortization += amort
+	r.Total += interest + amort
+	r.Projected = r.Projected || projected
+}
+
+// projectFlows returns the payments after settlementDate a holder of pos is entitled to. Indexed bonds are adjusted
+// by the ratio of the index at each payment date, extending the series at extendIndex past its last value, as legFlow.
+// Dual bonds pay the greater of both legs at each date.
+func (md *marketData) projectFlows(b Bond, pos Position, settlementDate time.Time, extendIndex float64) ([]ladderFlow, error) {
+	var flow []Flujo
+	indexed := b.Index != ""
+	projectedDual := false
+	if b.isDual() {
+		v, err := md.valueDual(b, settlementDate, 0, 0, 0, [2]float64{extendIndex, extendIndex})
+		if err != nil {
+			return nil, err
+		}
+		flow, indexed = v.flow, false // los montos de cada pata ya vienen ajustados
+		projectedDual = v.legs[0].Extrapolated || v.legs[1].Extrapolated
+	} else {
+		var err error
+		if flow, err = md.cashflow(b); err != nil {
+			return nil, err
+		}
+	}
+	_, entitled, err := md.entitlement(b, flow, settlementDate)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []ladderFlow
+	for _, cf := range entitled {
+		d := time.Time(cf.Date)
+		if d.Before(settlementDate) {
+			continue
+		}
+		lf := ladderFlow{Date: cf.Date, Ticker: b.Ticker, Currency: pos.Currency, Nominal: pos.Nominal, Ratio: 1, Projected: projectedDual}
+		if indexed {
+			adj, err := md.indexRatio(b, d, extendIndex)
+			if err != nil {
+				return nil, fmt.Errorf("payment of %s: %w", d.Format(DateFormat), err)
+			}
+			lf.Ratio, lf.Projected = adj.ratio, adj.extrapolated
+		}
+		scale := pos.Nominal / 100 * lf.Ratio
+		lf.Interest = (cf.Amount - cf.Amort) * scale
+		lf.Amortization = cf.Amort * scale
+		lf.Total = lf.Interest + lf.Amortization
+		out = append(out, lf)
+	}
+	return out, nil
+}
+
+// cashflowLadder aggregates the projected payments of the positions by bucket and currency. With baseCurrency the
+// payments are also converted with the fx param, each rate growing at the annual rate of fxGrowth (CUR:rate) from
+// the settlement date, into a single ladder in that currency.
+func cashflowLadder(c *gin.Context, name string, positions []Position) {
+	bucket, err := normalizeLadderBucket(c.Query("bucket"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	fx, err := parseKeyValues(c.Query("fx"), "fx", true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	fxGrowth, err := parseKeyValues(c.Query("fxGrowth"), "fxGrowth", false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	extendIndex := 0.0
+	if s := c.Query("extendIndex"); s != "" {
+		if extendIndex, err = strconv.ParseFloat(s, 64); err != nil || extendIndex < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "extendIndex should be a number greater or equal to 0"})
+			return
+		}
+	}
+	bonds, err := bondsForRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	normalizePositions(positions)
+	if err := validatePositions(positions, bonds); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	md, err := marketDataForRequest(c)
+	if err != nil {
+		c.JSON(indexErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	settlementDate, err := settlementDateFromQuery(c, "", bonds, md)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	portfolioCurrencies(positions, bonds)
+	// sin moneda no se pueden separar los flujos de distintas monedas
+	for _, pos := range positions {
+		if pos.Currency == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": pos.Ticker + ": the currency is not set, add Currency to the bond or the position"})
+			return
+		}
+	}
+	base := strings.ToUpper(c.Query("baseCurrency"))
+
+	var flows []ladderFlow
+	for _, pos := range positions {
+		_, index, _ := getCashFlow(bonds, pos.Ticker)
+		// cada posición liquida en el calendario de su bono, como en valuePositions
+		settle, err := settlementDateFromQuery(c, pos.Ticker, bonds, md)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": pos.Ticker + ": " + err.Error()})
+			return
+		}
+		pf, err := md.projectFlows(bonds[index], pos, settle, extendIndex)
+		if err != nil {
+			c.JSON(indexErrorStatus(err), gin.H{"error": pos.Ticker + ": " + err.Error()})
+			return
+		}
+		flows = append(flows, pf...)
+	}
+	sort.SliceStable(flows, func(i, j int) bool { return time.Time(flows[i].Date).Before(time.Time(flows[j].Date)) })
+
+	rows := map[string]*ladderRow{}
+	baseRows := map[string]*ladderRow{}
+	totals := map[string]ladderTotal{}
+	for _, f := range flows {
+		period, start := ladderPeriod(time.Time(f.Date), bucket)
+		key := period + "|" + f.Currency
+		if rows[key] == nil {
+			rows[key] = &ladderRow{Period: period, Start: Fecha(start), Currency: f.Currency}
+		}
+		rows[key].add(f.Interest, f.Amortization, f.Projected)
+		t := totals[f.Currency]
+		t.Interest += f.Interest
+		t.Amortization += f.Amortization
+		t.Total += f.Total
+		t.Projected = t.Projected || f.Projected
+		totals[f.Currency] = t
+
+		if base == "" {
+			continue
+		}
+		rate, err := fxRate(f.Currency, base, fx, f.Ticker)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		projected := f.Projected
+		if g, ok := fxGrowth[f.Currency]; ok && f.Currency != base {
+			years := time.Time(f.Date).Sub(settlementDate).Hours() / 24 / 365
+			rate *= math.Pow(1+g, years)
+			projected = true
+		}
+		if baseRows[period] == nil {
+			baseRows[period] = &ladderRow{Period: period, Start: Fecha(start), Currency: base}
+		}
+		baseRows[period].add(f.Interest*rate, f.Amortization*rate, projected)
+	}
+	sortedRows := func(m map[string]*ladderRow) []ladderRow {
+		out := []ladderRow{}
+		for _, r := range m {
+			out = append(out, *r)
+		}
+		sort.Slice(out, func(i, j int) bool {
+			if !time.Time(out[i].Start).Equal(time.Time(out[j].Start)) {
+				return time.Time(out[i].Start).Before(time.Time(out[j].Start))
+			}
+			return out[i].Currency < out[j].Currency
+		})
+		return out
+	}
+	ladder := sortedRows(rows)
+	baseLadder := sortedRows(baseRows)
+
+	if strings.EqualFold(c.Query("format"), "csv") {
+		out := ladder
+		if base != "" {
+			out = baseLadder
+		}
+		var buffer bytes.Buffer
+		writer := csv.NewWriter(&buffer)
+		writer.Write([]string{"period", "start", "currency", "interest", "amortization", "total", "projected"})
+		for _, r := range out {
+			writer.Write([]string{
+				r.Period,
+				r.Start.Format(DateFormat),
+				r.Currency,
+				strconv.FormatFloat(r.Interest, 'f', 2, 64),
+				strconv.FormatFloat(r.Amortization, 'f', 2, 64),
+				strconv.FormatFloat(r.Total, 'f', 2, 64),
+				strconv.FormatBool(r.Projected),
+			})
+		}
+		writer.Flush()
+		filename := name
+		if filename == "" {
+			filename = "ladder"
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment;filename=%s.csv", filename))
+		c.Data(http.StatusOK, "text/csv", buffer.Bytes())
+		return
+	}
+
+	out := gin.H{
+		"Name":           name,
+		"SettlementDate": Fecha(settlementDate),
+		"Bucket":         bucket,
+		"Ladder":         ladder,
+		"Totals":         totals,
+		"Payments":       flows,
+		"MarketData":     md,
+	}
+	if base != "" {
+		out["BaseCurrency"] = base
+		out["BaseLadder"] = baseLadder
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// portfolioLadderWrapper returns the cashflow ladder of a stored portfolio.
+func portfolioLadderWrapper(c *gin.Context) {
+	p, ok, err := portfolios.Get(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	} else if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "portfolio not found"})
+		return
+	}
+	cashflowLadder(c, p.Name, p.Positions)
+}
+
+// adhocLadderWrapper returns the cashflow ladder of the positions of the body ({"Positions": [...]}).
+func adhocLadderWrapper(c *gin.Context) {
+	var p Portfolio
+	if err := c.ShouldBindJSON(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cashflowLadder(c, p.Name, p.Positions)
+}
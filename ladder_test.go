@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLadderPeriod(t *testing.T) {
+	tests := []struct {
+		date   string
+		bucket string
+		period string
+		start  string
+	}{
+		{"2026-01-02", LadderMonth, "2026-01", "2026-01-01"},
+		{"2026-03-31", LadderQuarter, "2026-Q1", "2026-01-01"},
+		{"2026-04-01", LadderQuarter, "2026-Q2", "2026-04-01"},
+		{"2026-12-15", LadderQuarter, "2026-Q4", "2026-10-01"},
+		{"2026-12-15", LadderDate, "2026-12-15", "2026-12-15"},
+	}
+	for _, tt := range tests {
+		period, start := ladderPeriod(mustDate(tt.date), tt.bucket)
+		if period != tt.period || start.Format(DateFormat) != tt.start {
+			t.Errorf("%s by %s: %s from %s, want %s from %s", tt.date, tt.bucket, period, start.Format(DateFormat), tt.period, tt.start)
+		}
+	}
+}
+
+// ladderOut is the part of the ladder response checked by the tests.
+type ladderOut struct {
+	Ladder     []ladderRow
+	BaseLadder []ladderRow
+	Totals     map[string]ladderTotal
+	Payments   []ladderFlow
+}
+
+func TestCashflowLadder(t *testing.T) {
+	ars := tenPercentBond("ARX")
+	ars.Currency = "ARS"
+	setTestMarket(t, []Bond{tenPercentBond("USX"), ars}, nil, nil)
+	positions := func() []Position { return []Position{{Ticker: "USX", Nominal: 1000}, {Ticker: "ARX", Nominal: 200}} }
+	// del 2025-06-02 al primer pago del 2026-01-02
+	years := 214.0 / 365
+
+	tests := []struct {
+		name      string
+		query     string
+		rows      int                // rows of Ladder
+		first     map[string]float64 // total of the first period by currency
+		base      float64            // total of the first period of BaseLadder, 0 without baseCurrency
+		projected bool               // projected flag of that row
+		totals    map[string]float64 // totals by currency
+	}{
+		{"by quarter", "?settlementDate=2025-06-02&bucket=quarter", 8, map[string]float64{"USD": 100, "ARS": 20}, 0, false, map[string]float64{"USD": 1400, "ARS": 280}},
+		{"in pesos", "?settlementDate=2025-06-02&bucket=quarter&baseCurrency=ARS&fx=USD:1000", 8, map[string]float64{"USD": 100, "ARS": 20}, 100*1000 + 20, false, map[string]float64{"USD": 1400, "ARS": 280}},
+		{"with the dollar growing", "?settlementDate=2025-06-02&bucket=quarter&baseCurrency=ARS&fx=USD:1000&fxGrowth=USD:0.1", 8, map[string]float64{"USD": 100, "ARS": 20}, 100*1000*math.Pow(1.1, years) + 20, true, map[string]float64{"USD": 1400, "ARS": 280}},
+		{"after the first payment", "?settlementDate=2026-01-05&bucket=month", 6, map[string]float64{"USD": 100, "ARS": 20}, 0, false, map[string]float64{"USD": 1300, "ARS": 260}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/portfolios/ladder"+tt.query, nil)
+			cashflowLadder(c, "", positions())
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body.String())
+			}
+			var out ladderOut
+			if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+				t.Fatal(err)
+			}
+			if len(out.Ladder) != tt.rows {
+				t.Fatalf("%d rows, want %d", len(out.Ladder), tt.rows)
+			}
+			start := out.Ladder[0].Start
+			for _, r := range out.Ladder {
+				if r.Start == start && math.Abs(r.Total-tt.first[r.Currency]) > 1e-9 {
+					t.Errorf("%s %s: %v, want %v", r.Period, r.Currency, r.Total, tt.first[r.Currency])
+				}
+				if math.Abs(r.Interest+r.Amortization-r.Total) > 1e-9 {
+					t.Errorf("%s %s: interest and amortization don't add up to the total", r.Period, r.Currency)
+				}
+			}
+			for cur, want := range tt.totals {
+				if math.Abs(out.Totals[cur].Total-want) > 1e-9 {
+					t.Errorf("total %s %v, want %v", cur, out.Totals[cur].Total, want)
+				}
+			}
+			if tt.base == 0 {
+				if len(out.BaseLadder) != 0 {
+					t.Error("BaseLadder without baseCurrency")
+				}
+				return
+			}
+			if len(out.BaseLadder) != tt.rows/2 {
+				t.Fatalf("%d rows in pesos, want %d", len(out.BaseLadder), tt.rows/2)
+			}
+			if r := out.BaseLadder[0]; math.Abs(r.Total-tt.base) > 1e-6 || r.Currency != "ARS" || r.Projected != tt.projected {
+				t.Errorf("first row in pesos %+v, want %v projected %v", r, tt.base, tt.projected)
+			}
+		})
+	}
+}
+
+// Each position projects the payments it is entitled to from the settlement on its bond's calendar.
+func TestCashflowLadderSettlesOnBondCalendar(t *testing.T) {
+	bond := func(ticker string, calendar string) Bond {
+		return Bond{ID: ticker, Ticker: ticker, IssueDate: Fecha(mustDate("2024-06-19")), Maturity: Fecha(mustDate("2026-06-19")), Calendar: calendar, Currency: "USD", Issuer: "corporate",
+			Cashflow: []Flujo{
+				{Date: Fecha(mustDate("2025-06-19")), Rate: 0.1, Residual: 100, Amount: 10},
+				{Date: Fecha(mustDate("2026-06-19")), Rate: 0.1, Amort: 100, Amount: 110},
+			}}
+	}
+	setTestMarket(t, []Bond{bond("ALX", ""), bond("GDX", "NY")}, nil, nil)
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	// T+1 del 2025-06-18 es el día del pago en Argentina, pero el bono NY pasa por Juneteenth y liquida el 20, sin el cupón
+	c.Request = httptest.NewRequest(http.MethodPost, "/portfolios/ladder?tradeDate=2025-06-18&bucket=date", nil)
+	cashflowLadder(c, "", []Position{{Ticker: "ALX", Nominal: 100}, {Ticker: "GDX", Nominal: 100}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var out ladderOut
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	count := map[string]int{}
+	for _, p := range out.Payments {
+		count[p.Ticker]++
+	}
+	if count["ALX"] != 2 || count["GDX"] != 1 {
+		t.Errorf("payments by ticker %v, want ALX 2 and GDX 1", count)
+	}
+}
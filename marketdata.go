@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rickar/cal/v2"
+)
+
+// errDataUnavailable marks errors caused by market data that is not loaded (yet). Handlers answer them with 503.
+var errDataUnavailable = errors.New("data unavailable")
+
+// marketData is the index series (CER, UVA) and calendars a request is valued with: the ones loaded now,
+// or the ones that were known at AsOf, taken from the snapshots.
+type marketData struct {
+	indices   map[string]*IndexSeries
+	calendars map[string]*cal.BusinessCalendar
+	current   bool
+	gapPolicy string // how dates without a published index value are resolved, see normalizeGapPolicy
+
+	AsOf             *time.Time `json:",omitempty"`
+	CERLoadedAt      *time.Time `json:",omitempty"`
+	UVALoadedAt      *time.Time `json:",omitempty"`
+	HolidaysLoadedAt *time.Time `json:",omitempty"`
+}
+
+// indexAdj is the adjustment of an indexed bond: ratio = coefUsed / coefIssue.
+// extrapolated is set if any of both coefficients had to be extended past the end of the series.
+type indexAdj struct {
+	ratio        float64
+	coefUsed     float64
+	coefIssue    float64
+	coefDate     time.Time
+	usedStatus   string
+	issueStatus  string
+	extrapolated bool
+}
+
+func currentMarketData() *marketData {
+	md := &marketData{indices: currentIndices(), current: true, gapPolicy: GapError}
+	calendarsMu.RLock()
+	md.calendars = calendars
+	calendarsMu.RUnlock()
+	for _, d := range dependencies() {
+		md.setLoadedAt(d.Name, d.LastSuccess)
+	}
+	return md
+}
+
+// marketDataAsOf rebuilds the market data from the last snapshots loaded at or before asOf.
+func marketDataAsOf(asOf time.Time) (*marketData, error) {
+	md := &marketData{AsOf: &asOf, indices: map[string]*IndexSeries{}, gapPolicy: GapError}
+
+	var holidays []time.Time
+	loaded, err := snapshots.LoadAsOf(snapshotHolidays, asOf, &holidays)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errDataUnavailable, err)
+	}
+	md.HolidaysLoadedAt = &loaded
+	md.calendars = buildCalendars(holidays)
+
+	// los índices son opcionales: sin snapshot los bonos no indexados se valúan igual
+	for _, name := range indexNames {
+		var obs []CER
+		loaded, err := snapshots.LoadAsOf(name, asOf, &obs)
+		if errors.Is(err, errNoSnapshot) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		series, err := newIndexSeries(name, obs)
+		if err != nil {
+			return nil, err
+		}
+		md.indices[name] = series
+		md.setLoadedAt(name, &loaded)
+	}
+	return md, nil
+}
+
+// setLoadedAt records when the data of a dependency used by md was loaded.
+func (md *marketData) setLoadedAt(name string, t *time.Time) {
+	switch name {
+	case depCER:
+		md.CERLoadedAt = t
+	case depUVA:
+		md.UVALoadedAt = t
+	case depHolidays:
+		md.HolidaysLoadedAt = t
+	}
+}
+
+// marketDataForRequest returns the market data as of the asOf param, or the current one if it is missing.
+// The gapPolicy param sets how gaps inside the index series are resolved.
+func marketDataForRequest(c *gin.Context) (*marketData, error) {
+	gapPolicy, err := normalizeGapPolicy(c.Query("gapPolicy"))
+	if err != nil {
+		return nil, err
+	}
+	var md *marketData
+	if s := c.Query("asOf"); s == "" {
+		md = currentMarketData()
+	} else {
+		asOf, err := parseAsOf(s)
+		if err != nil {
+			return nil, err
+		}
+		if md, err = marketDataAsOf(asOf); err != nil {
+			return nil, err
+		}
+	}
+	md.gapPolicy = gapPolicy
+	return md, nil
+}
+
+func (md *marketData) calendar(name string) (*cal.BusinessCalendar, error) {
+	n, err := normalizeCalendar(name)
+	if err != nil {
+		return nil, err
+	}
+	return md.calendars[n], nil
+}
+
+// cashflow returns the bond's cashflow with the dates rolled on its calendar.
+func (md *marketData) cashflow(b Bond) ([]Flujo, error) {
+	c, err := md.calendar(b.Calendar)
+	if err != nil {
+		return nil, err
+	}
+	return adjustCashflow(b, c)
+}
+
+// indexRatio computes the adjustment of an indexed bond for settlementDate: the coefficient of the
+// settlement date over the one of the issue date, both moved Offset business days.
+// Non-indexed bonds get a ratio of 1.
+func (md *marketData) indexRatio(b Bond, settlementDate time.Time, extendIndex float64) (indexAdj, error) {
+	adj := indexAdj{ratio: 1}
+	if b.Index == "" {
+		return adj, nil
+	}
+	if md.current {
+		if err := indexUnavailable(b.Index); err != nil {
+			return adj, fmt.Errorf("%w: %v", errDataUnavailable, err)
+		}
+	}
+	series, err := md.indexSeries(b.Index)
+	if err != nil {
+		return adj, err
+	}
+
+	var issueCoefDate time.Time
+	adj.coefDate, issueCoefDate = md.indexCoefDates(b, settlementDate)
+	used, err := series.Lookup(adj.coefDate, extendIndex, md.gapPolicy)
+	if err != nil {
+		return adj, err
+	}
+	issue, err := series.Lookup(issueCoefDate, extendIndex, md.gapPolicy)
+	if err != nil {
+		return adj, err
+	}
+	adj.coefUsed, adj.usedStatus = used.Value, used.Status
+	adj.coefIssue, adj.issueStatus = issue.Value, issue.Status
+	adj.extrapolated = used.Extrapolated || issue.Extrapolated
+	adj.ratio = adj.coefUsed / adj.coefIssue
+	return adj, nil
+}
+
+// indexCoefDates returns the dates of the index values that adjust b on date and on its issue date:
+// Offset business days (AR) from each.
+func (md *marketData) indexCoefDates(b Bond, date time.Time) (time.Time, time.Time) {
+	ar := md.calendars[CalendarAR]
+	issueDate, _ := time.Parse(DateFormat, (b.IssueDate.Format(DateFormat)))
+	return ar.WorkdaysFrom(date, b.Offset), ar.WorkdaysFrom(issueDate, b.Offset)
+}
+
+// indexSeries returns the loaded series of the index named name.
+func (md *marketData) indexSeries(name string) (*IndexSeries, error) {
+	name = strings.ToUpper(name)
+	if !knownIndex(name) {
+		return nil, fmt.Errorf("unknown index %q", name)
+	}
+	series := md.indices[name]
+	if series.Len() == 0 {
+		if md.AsOf != nil {
+			return nil, fmt.Errorf("%w: no %s snapshot as of %s", errDataUnavailable, name, md.AsOf.Format(time.RFC3339))
+		}
+		return nil, fmt.Errorf("%w: %s index not loaded yet, try again later", errDataUnavailable, name)
+	}
+	return series, nil
+}
+
+// knownIndex reports whether bonds can be adjusted by the index.
+func knownIndex(name string) bool {
+	for _, n := range indexNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// indexErrorStatus is the http status for an error of indexRatio.
+func indexErrorStatus(err error) int {
+	if errors.Is(err, errDataUnavailable) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,555 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Inflation models of the simulation.
+const (
+	InflationAR1     = "ar1"     // monthly inflation pi(t) = mean + phi*(pi(t-1)-mean) + sigma*e
+	InflationMonthly = "monthly" // independent normal per month with the user's mean and stdev, the last one repeated
+)
+
+// Límites y defaults de la simulación.
+const (
+	defaultSimPaths   = 1000
+	maxSimPaths       = 20000
+	defaultSimSeed    = 1
+	simDaysPerMonth   = 365.25 / 12
+	simEstimateMonths = 24 // months of the index used to estimate the AR(1) when its params are not given
+
+	// rango de inflación mensual en el que se busca el breakeven
+	simBreakevenMin = -0.05
+	simBreakevenMax = 0.5
+)
+
+// inflationModel draws paths of monthly inflation.
+type inflationModel struct {
+	Model string
+	Mean  float64   `json:",omitempty"`
+	Phi   float64   `json:",omitempty"`
+	Sigma float64   `json:",omitempty"`
+	Start float64   `json:",omitempty"` // inflation of the month before the first simulated one
+	Means []float64 `json:",omitempty"`
+	Stdev []float64 `json:",omitempty"`
+}
+
+// path draws n months of inflation. Months can't deflate by more than 99%.
+func (m inflationModel) path(r *rand.Rand, n int) []float64 {
+	out := make([]float64, n)
+	prev := m.Start
+	for i := range out {
+		var pi float64
+		switch m.Model {
+		case InflationMonthly:
+			k := i
+			if k >= len(m.Means) {
+				k = len(m.Means) - 1
+			}
+			pi = m.Means[k] + m.Stdev[k]*r.NormFloat64()
+		default:
+			pi = m.Mean + m.Phi*(prev-m.Mean) + m.Sigma*r.NormFloat64()
+		}
+		out[i] = math.Max(pi, -0.99)
+		prev = out[i]
+	}
+	return out
+}
+
+// monthlyChanges returns the changes of the series every month (of simDaysPerMonth days, interpolating between
+// published values) over the last months before its last value.
+func monthlyChanges(series *IndexSeries, months int) ([]float64, error) {
+	last := series.Last()
+	var out []float64
+	prev := 0.0
+	for k := months; k >= 0; k-- {
+		d := last.Date.Add(-time.Duration(float64(k)*simDaysPerMonth*24) * time.Hour)
+		v, err := series.Lookup(d, 0, GapInterpolate)
+		if err != nil {
+			return nil, err
+		}
+		if k < months {
+			out = append(out, v.Value/prev-1)
+		}
+		prev = v.Value
+	}
+	return out, nil
+}
+
+// estimateAR1 fits mean, phi and sigma of an AR(1) to the monthly changes by least squares. Phi is kept in [0, 0.99].
+func estimateAR1(x []float64) (mean float64, phi float64, sigma float64) {
+	for _, v := range x {
+		mean += v
+	}
+	mean /= float64(len(x))
+	num, den := 0.0, 0.0
+	for i := 1; i < len(x); i++ {
+		num += (x[i] - mean) * (x[i-1] - mean)
+		den += (x[i-1] - mean) * (x[i-1] - mean)
+	}
+	if den > 0 {
+		phi = num / den
+	}
+	phi = math.Min(math.Max(phi, 0), 0.99)
+	ss := 0.0
+	for i := 1; i < len(x); i++ {
+		e := x[i] - mean - phi*(x[i-1]-mean)
+		ss += e * e
+	}
+	if len(x) > 2 {
+		sigma = math.Sqrt(ss / float64(len(x)-2))
+	}
+	return mean, phi, sigma
+}
+
+// inflationModelFromQuery reads the model params. The AR(1) params that are not given are estimated from the
+// last simEstimateMonths months of the series, and it starts from the last monthly change.
+func inflationModelFromQuery(c *gin.Context, series *IndexSeries) (inflationModel, error) {
+	m := inflationModel{Model: strings.ToLower(c.DefaultQuery("model", InflationAR1))}
+	switch m.Model {
+	case InflationMonthly:
+		s := c.Query("monthly")
+		if s == "" {
+			return m, errors.New("monthly is required with model=monthly, as mean:stdev,mean:stdev per month")
+		}
+		for _, part := range strings.Split(s, ",") {
+			kv := strings.SplitN(strings.TrimSpace(part), ":", 2)
+			mean, err := strconv.ParseFloat(kv[0], 64)
+			if err != nil {
+				return m, fmt.Errorf("invalid monthly %q, use mean:stdev", part)
+			}
+			stdev := 0.0
+			if len(kv) == 2 {
+				if stdev, err = strconv.ParseFloat(kv[1], 64); err != nil || stdev < 0 {
+					return m, fmt.Errorf("invalid monthly %q, use mean:stdev", part)
+				}
+			}
+			m.Means = append(m.Means, mean)
+			m.Stdev = append(m.Stdev, stdev)
+		}
+		return m, nil
+	case InflationAR1:
+		changes, err := monthlyChanges(series, simEstimateMonths)
+		if err != nil {
+			return m, err
+		}
+		m.Mean, m.Phi, m.Sigma = estimateAR1(changes)
+		m.Start = changes[len(changes)-1]
+		params := []struct {
+			name string
+			v    *float64
+		}{{"mean", &m.Mean}, {"phi", &m.Phi}, {"sigma", &m.Sigma}, {"start", &m.Start}}
+		for _, p := range params {
+			if s := c.Query(p.name); s != "" {
+				if *p.v, err = strconv.ParseFloat(s, 64); err != nil {
+					return m, fmt.Errorf("%s should be a number", p.name)
+				}
+			}
+		}
+		if m.Sigma < 0 || m.Phi <= -1 || m.Phi >= 1 {
+			return m, errors.New("sigma should not be negative and phi should be between -1 and 1")
+		}
+		return m, nil
+	}
+	return m, fmt.Errorf("unknown model %q, use ar1 or monthly", m.Model)
+}
+
+// pathIndex is the index along one simulated path: the published series up to its last value and, after it,
+// the last value compounded with the monthly inflation of the path (pro rata within a month).
+type pathIndex struct {
+	series    *IndexSeries
+	gapPolicy string
+	last      CER
+	factors   []float64 // cumulative growth at the end of each month
+	inflation []float64
+}
+
+func newPathIndex(series *IndexSeries, gapPolicy string, inflation []float64) *pathIndex {
+	p := &pathIndex{series: series, gapPolicy: gapPolicy, last: series.Last(), inflation: inflation, factors: make([]float64, len(inflation))}
+	f := 1.0
+	for i, pi := range inflation {
+		f *= 1 + pi
+		p.factors[i] = f
+	}
+	return p
+}
+
+func (p *pathIndex) value(date time.Time) (float64, error) {
+	if !date.After(p.last.Date) {
+		v, err := p.series.Lookup(date, 0, p.gapPolicy)
+		return v.Value, err
+	}
+	m := date.Sub(p.last.Date).Hours() / 24 / simDaysPerMonth
+	k := int(m)
+	if k >= len(p.inflation) {
+		return 0, fmt.Errorf("the path ends before %s", date.Format(DateFormat))
+	}
+	f := 1.0
+	if k > 0 {
+		f = p.factors[k-1]
+	}
+	return p.last.CER * f * math.Pow(1+p.inflation[k], m-float64(k)), nil
+}
+
+// ratio is the index ratio of b on date along the path, with the lags of indexRatio.
+func (p *pathIndex) ratio(md *marketData, b Bond, date time.Time) (float64, error) {
+	used, issue := md.indexCoefDates(b, date)
+	u, err := p.value(used)
+	if err != nil {
+		return 0, err
+	}
+	i, err := p.value(issue)
+	if err != nil {
+		return 0, err
+	}
+	return u / i, nil
+}
+
+// horizonValue is what a holder from settlementDate to horizon has at the horizon per 100 of original face value:
+// the payments received (adjusted with ratioAt on their date, not reinvested) plus the remaining ones priced at rate
+// and adjusted on the horizon, so an indexed bond keeps its real yield.
+func horizonValue(flow []Flujo, rate float64, settlementDate time.Time, horizon time.Time, ratioAt func(time.Time) (float64, error)) (float64, error) {
+	v := 0.0
+	var remaining []Flujo
+	for _, cf := range flow {
+		d := time.Time(cf.Date)
+		switch {
+		case d.Before(settlementDate):
+		case !d.After(horizon):
+			r, err := ratioAt(d)
+			if err != nil {
+				return 0, err
+			}
+			v += cf.Amount * r
+		default:
+			remaining = append(remaining, cf)
+		}
+	}
+	if len(remaining) > 0 {
+		p, err, _ := Price(remaining, rate, horizon, 0, 0)
+		if err != nil {
+			return 0, err
+		}
+		r, err := ratioAt(horizon)
+		if err != nil {
+			return 0, err
+		}
+		v += p * r
+	}
+	return v, nil
+}
+
+// distribution summarizes simulated values.
+type distribution struct {
+	Mean   float64
+	StdDev float64
+	Min    float64
+	P5     float64
+	P25    float64
+	P50    float64
+	P75    float64
+	P95    float64
+	Max    float64
+}
+
+func newDistribution(x []float64) distribution {
+	var d distribution
+	if len(x) == 0 {
+		return d
+	}
+	s := make([]float64, len(x))
+	copy(s, x)
+	sort.Float64s(s)
+	for _, v := range s {
+		d.Mean += v
+	}
+	d.Mean /= float64(len(s))
+	for _, v := range s {
+		d.StdDev += (v - d.Mean) * (v - d.Mean)
+	}
+	if len(s) > 1 {
+		d.StdDev = math.Sqrt(d.StdDev / float64(len(s)-1))
+	}
+	q := func(p float64) float64 {
+		h := p * float64(len(s)-1)
+		i := int(h)
+		if i+1 >= len(s) {
+			return s[len(s)-1]
+		}
+		return s[i] + (h-float64(i))*(s[i+1]-s[i])
+	}
+	d.Min, d.P5, d.P25, d.P50, d.P75, d.P95, d.Max = s[0], q(0.05), q(0.25), q(0.5), q(0.75), q(0.95), s[len(s)-1]
+	return d
+}
+
+// breakevenInflation finds by bisection the constant monthly inflation between simBreakevenMin and simBreakevenMax
+// at which diff, the return of the indexed bond less the one of the fixed-rate bond, is 0.
+func breakevenInflation(diff func(float64) (float64, error)) (float64, error) {
+	lo, hi := simBreakevenMin, simBreakevenMax
+	fLo, err := diff(lo)
+	if err != nil {
+		return 0, err
+	}
+	fHi, err := diff(hi)
+	if err != nil {
+		return 0, err
+	}
+	if fLo == 0 {
+		return lo, nil
+	}
+	if fHi == 0 {
+		return hi, nil
+	}
+	if fLo*fHi > 0 {
+		return 0, fmt.Errorf("the returns don't cross with a monthly inflation between %g%% and %g%%", simBreakevenMin*100, simBreakevenMax*100)
+	}
+	for i := 0; i < 100 && hi-lo > 1e-10; i++ {
+		mid := (lo + hi) / 2
+		f, err := diff(mid)
+		if err != nil {
+			return 0, err
+		}
+		if f*fLo > 0 {
+			lo, fLo = mid, f
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2, nil
+}
+
+// simBond is a bond of the simulation bought at its dirty price on the settlement date.
+type simBond struct {
+	bond  Bond
+	value positionValue
+	flow  []Flujo
+}
+
+func simBondFromQuery(c *gin.Context, md *marketData, bonds []Bond, tickerParam string, priceParam string, settlementDate time.Time) (*simBond, error) {
+	ticker := strings.ToUpper(c.Query(tickerParam))
+	_, index, err := getCashFlow(bonds, ticker)
+	if err != nil {
+		return nil, fmt.Errorf("%s: ticker not found", tickerParam)
+	}
+	b := bonds[index]
+	if b.isDual() {
+		return nil, fmt.Errorf("%s: dual bonds are not supported", ticker)
+	}
+	price, err := strconv.ParseFloat(c.Query(priceParam), 64)
+	if err != nil || price <= 0 {
+		return nil, fmt.Errorf("%s should be a number greater than 0", priceParam)
+	}
+	priceType, err := priceTypeFor(b, c.Query(priceParam+"Type"))
+	if err != nil {
+		return nil, err
+	}
+	pv, err := valuePosition(md, b, Position{Ticker: ticker, Nominal: 100}, price, priceType, settlementDate, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ticker, err)
+	}
+	flow, err := md.cashflow(b)
+	if err != nil {
+		return nil, err
+	}
+	if _, flow, err = md.entitlement(b, flow, settlementDate); err != nil {
+		return nil, err
+	}
+	return &simBond{bond: b, value: pv, flow: flow}, nil
+}
+
+// simulateWrapper simulates monthly inflation paths, projects the index of an indexed bond (BONCER, LECER) along each
+// and returns the distribution of its nominal and real holding-period returns up to the horizon, against a fixed-rate
+// bond (LECAP) held over the same period if compare is given.
+func simulateWrapper(c *gin.Context) {
+	ticker := strings.ToUpper(c.Query("ticker"))
+	paths := defaultSimPaths
+	if s := c.Query("paths"); s != "" {
+		var err error
+		if paths, err = strconv.Atoi(s); err != nil || paths < 1 || paths > maxSimPaths {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "paths should be between 1 and " + strconv.Itoa(maxSimPaths)})
+			return
+		}
+	}
+	seed := int64(defaultSimSeed)
+	if s := c.Query("seed"); s != "" {
+		var err error
+		if seed, err = strconv.ParseInt(s, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "seed should be an integer"})
+			return
+		}
+	}
+	bonds, err := bondsForRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	md, err := marketDataForRequest(c)
+	if err != nil {
+		c.JSON(indexErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	settlementDate, err := settlementDateFromQuery(c, ticker, bonds, md)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	bond, err := simBondFromQuery(c, md, bonds, "ticker", "price", settlementDate)
+	if err != nil {
+		c.JSON(indexErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if bond.bond.Index == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ticker + " is not indexed, use a CER or UVA bond"})
+		return
+	}
+	// la tasa real sale del precio, así que el índice al settlement tiene que estar publicado
+	if adj, err := md.indexRatio(bond.bond, settlementDate, 0); err != nil || adj.extrapolated {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "the " + bond.bond.Index + " of the settlement date is not published yet, use an earlier settlementDate or asOf"})
+		return
+	}
+	var compare *simBond
+	if c.Query("compare") != "" {
+		if compare, err = simBondFromQuery(c, md, bonds, "compare", "comparePrice", settlementDate); err != nil {
+			c.JSON(indexErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if compare.bond.Index != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "compare should be a fixed-rate bond"})
+			return
+		}
+	}
+
+	horizon := time.Time(bond.bond.Maturity)
+	if compare != nil && time.Time(compare.bond.Maturity).Before(horizon) {
+		horizon = time.Time(compare.bond.Maturity)
+	}
+	if s := c.Query("horizon"); s != "" {
+		if horizon, err = time.Parse(DateFormat, s); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid horizon date"})
+			return
+		}
+	}
+	if !horizon.After(settlementDate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "horizon should be after the settlement date"})
+		return
+	}
+
+	series, err := md.indexSeries(bond.bond.Index)
+	if err != nil {
+		c.JSON(indexSeriesErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	model, err := inflationModelFromQuery(c, series)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	months := int(horizon.Sub(series.Last().Date).Hours()/24/simDaysPerMonth) + 2
+	if months < 1 {
+		months = 1
+	}
+
+	// retorno de la LECAP: no depende de la inflación
+	compareReturn := 0.0
+	if compare != nil {
+		v, err := horizonValue(compare.flow, compare.value.Yield, settlementDate, horizon, func(time.Time) (float64, error) { return 1, nil })
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": compare.bond.Ticker + ": " + err.Error()})
+			return
+		}
+		compareReturn = v/compare.value.DirtyPrice - 1
+	}
+
+	// retorno nominal y real del bono CER en un camino de inflación
+	run := func(inflation []float64) (float64, float64, error) {
+		p := newPathIndex(series, md.gapPolicy, inflation)
+		v, err := horizonValue(bond.flow, bond.value.Yield, settlementDate, horizon, func(d time.Time) (float64, error) { return p.ratio(md, bond.bond, d) })
+		if err != nil {
+			return 0, 0, err
+		}
+		start, _ := md.indexCoefDates(bond.bond, settlementDate)
+		end, _ := md.indexCoefDates(bond.bond, horizon)
+		i0, err := p.value(start)
+		if err != nil {
+			return 0, 0, err
+		}
+		i1, err := p.value(end)
+		if err != nil {
+			return 0, 0, err
+		}
+		return v/bond.value.DirtyPrice - 1, i1/i0 - 1, nil
+	}
+
+	r := rand.New(rand.NewSource(seed))
+	var nominal, real, inflation, compareReal, excess []float64
+	beats := 0
+	for k := 0; k < paths; k++ {
+		n, infl, err := run(model.path(r, months))
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		nominal = append(nominal, n)
+		inflation = append(inflation, infl)
+		real = append(real, (1+n)/(1+infl)-1)
+		if compare != nil {
+			compareReal = append(compareReal, (1+compareReturn)/(1+infl)-1)
+			excess = append(excess, n-compareReturn)
+			if n > compareReturn {
+				beats++
+			}
+		}
+	}
+
+	out := gin.H{
+		"Ticker":         bond.bond.Ticker,
+		"Index":          bond.bond.Index,
+		"SettlementDate": Fecha(settlementDate),
+		"Horizon":        Fecha(horizon),
+		"Price":          bond.value.DirtyPrice,
+		"RealYield":      bond.value.Yield,
+		"Paths":          paths,
+		"Seed":           seed,
+		"Model":          model,
+		"Inflation":      newDistribution(inflation),
+		"NominalReturn":  newDistribution(nominal),
+		"RealReturn":     newDistribution(real),
+		"MarketData":     md,
+	}
+	if compare != nil {
+		out["Compare"] = gin.H{
+			"Ticker":        compare.bond.Ticker,
+			"Price":         compare.value.DirtyPrice,
+			"Yield":         compare.value.Yield,
+			"NominalReturn": compareReturn,
+			"RealReturn":    newDistribution(compareReal),
+		}
+		out["ExcessReturn"] = newDistribution(excess)
+		out["ProbabilityIndexedBeats"] = float64(beats) / float64(paths)
+		// inflación mensual constante con la que ambos rinden lo mismo
+		diff := func(pi float64) (float64, error) {
+			flat := make([]float64, months)
+			for i := range flat {
+				flat[i] = pi
+			}
+			n, _, err := run(flat)
+			return n - compareReturn, err
+		}
+		if pi, err := breakevenInflation(diff); err != nil {
+			out["BreakevenError"] = err.Error()
+		} else {
+			out["BreakevenMonthlyInflation"] = pi
+		}
+	}
+	c.JSON(http.StatusOK, out)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEstimateAR1(t *testing.T) {
+	// una serie larga simulada con parámetros conocidos
+	m := inflationModel{Model: InflationAR1, Mean: 0.03, Phi: 0.6, Sigma: 0.01, Start: 0.03}
+	x := m.path(rand.New(rand.NewSource(7)), 20000)
+	mean, phi, sigma := estimateAR1(x)
+	if math.Abs(mean-0.03) > 0.001 || math.Abs(phi-0.6) > 0.03 || math.Abs(sigma-0.01) > 0.0005 {
+		t.Errorf("estimated mean %v phi %v sigma %v, want 0.03 0.6 0.01", mean, phi, sigma)
+	}
+
+	tests := []struct {
+		name                string
+		x                   []float64
+		mean, phi, sigmaMax float64
+	}{
+		{"constant", []float64{0.02, 0.02, 0.02, 0.02}, 0.02, 0, 0},
+		{"alternating keeps phi at 0", []float64{0.01, 0.03, 0.01, 0.03, 0.01, 0.03}, 0.02, 0, 0.02},
+		{"trend keeps phi below 1", []float64{0.01, 0.02, 0.03, 0.04, 0.05, 0.06}, 0.035, 0.99, 0.02},
+	}
+	for _, tt := range tests {
+		mean, phi, sigma := estimateAR1(tt.x)
+		if math.Abs(mean-tt.mean) > 1e-12 || phi < 0 || phi > tt.phi+1e-12 || (tt.phi == 0 && phi != 0) || sigma < 0 || sigma > tt.sigmaMax+1e-12 {
+			t.Errorf("%s: mean %v phi %v sigma %v", tt.name, mean, phi, sigma)
+		}
+	}
+}
+
+func TestInflationModelPath(t *testing.T) {
+	ar1 := inflationModel{Model: InflationAR1, Mean: 0.03, Phi: 0.5, Sigma: 0.02, Start: 0.04}
+	a := ar1.path(rand.New(rand.NewSource(1)), 36)
+	b := ar1.path(rand.New(rand.NewSource(1)), 36)
+	c := ar1.path(rand.New(rand.NewSource(2)), 36)
+	if !reflect.DeepEqual(a, b) {
+		t.Error("the same seed gives different paths")
+	}
+	if reflect.DeepEqual(a, c) {
+		t.Error("different seeds give the same path")
+	}
+
+	flat := inflationModel{Model: InflationAR1, Mean: 0.03, Phi: 0.5, Start: 0.05}.path(rand.New(rand.NewSource(1)), 3)
+	if want := []float64{0.04, 0.035, 0.0325}; math.Abs(flat[0]-want[0])+math.Abs(flat[1]-want[1])+math.Abs(flat[2]-want[2]) > 1e-12 {
+		t.Errorf("without noise the path reverts to the mean: %v, want %v", flat, want)
+	}
+	monthly := inflationModel{Model: InflationMonthly, Means: []float64{0.05, 0.03}, Stdev: []float64{0, 0}}.path(rand.New(rand.NewSource(1)), 4)
+	if !reflect.DeepEqual(monthly, []float64{0.05, 0.03, 0.03, 0.03}) {
+		t.Errorf("monthly path %v, want the last month repeated", monthly)
+	}
+	deflation := inflationModel{Model: InflationAR1, Mean: -5}.path(rand.New(rand.NewSource(1)), 2)
+	if deflation[0] != -0.99 || deflation[1] != -0.99 {
+		t.Errorf("deflation %v, want it floored at -99%%", deflation)
+	}
+}
+
+func TestPathIndexValue(t *testing.T) {
+	series, err := newIndexSeries("CER", dailyCER("2024-01-01", "2024-06-30"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := series.Last()
+	p := newPathIndex(series, GapError, []float64{0.01, 0.02})
+	month := time.Duration(simDaysPerMonth * 24 * float64(time.Hour))
+	tests := []struct {
+		name    string
+		date    time.Time
+		want    float64
+		wantErr bool
+	}{
+		{"published value", mustDate("2024-03-01"), 0, false},
+		{"last value", last.Date, last.CER, false},
+		{"half of the first month", last.Date.Add(month / 2), last.CER * math.Pow(1.01, 0.5), false},
+		{"half of the second month", last.Date.Add(month + month/2), last.CER * 1.01 * math.Pow(1.02, 0.5), false},
+		{"past the path", last.Date.Add(3 * month), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.value(tt.date)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want error %v", err, tt.wantErr)
+			}
+			want := tt.want
+			if want == 0 && !tt.wantErr {
+				v, _ := series.Lookup(tt.date, 0, GapError)
+				want = v.Value
+			}
+			if math.Abs(got-want) > 1e-6 {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestNewDistribution(t *testing.T) {
+	var x []float64
+	for i := 100; i >= 0; i-- {
+		x = append(x, float64(i))
+	}
+	d := newDistribution(x)
+	// desvío muestral de 0..100: la varianza es n(n+1)/12 con n = 101 valores
+	want := distribution{Mean: 50, StdDev: math.Sqrt(101.0 * 102.0 / 12.0), Min: 0, P5: 5, P25: 25, P50: 50, P75: 75, P95: 95, Max: 100}
+	if math.Abs(d.StdDev-want.StdDev) > 1e-9 {
+		t.Errorf("stdev %v, want %v", d.StdDev, want.StdDev)
+	}
+	d.StdDev = want.StdDev
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("got %+v, want %+v", d, want)
+	}
+	if x[0] != 100 {
+		t.Error("the values were sorted in place")
+	}
+	if got := newDistribution([]float64{2, 4}); got.P50 != 3 || got.Mean != 3 || got.P5 != 2.1 {
+		t.Errorf("two values: %+v", got)
+	}
+	if got := newDistribution(nil); got != (distribution{}) {
+		t.Errorf("empty: %+v", got)
+	}
+	if got := newDistribution([]float64{7}); got.StdDev != 0 || got.P95 != 7 || got.Min != 7 {
+		t.Errorf("one value: %+v", got)
+	}
+}
+
+func TestBreakevenInflation(t *testing.T) {
+	failing := errors.New("path failed")
+	tests := []struct {
+		name    string
+		diff    func(float64) (float64, error)
+		want    float64
+		wantErr bool
+	}{
+		{"crosses", func(pi float64) (float64, error) { return pi - 0.02, nil }, 0.02, false},
+		{"crosses downwards", func(pi float64) (float64, error) { return 0.1 - pi, nil }, 0.1, false},
+		{"at the lower end", func(pi float64) (float64, error) { return pi - simBreakevenMin, nil }, simBreakevenMin, false},
+		{"indexed always ahead", func(pi float64) (float64, error) { return 1 + pi, nil }, 0, true},
+		{"above the range", func(pi float64) (float64, error) { return pi - 0.6, nil }, 0, true},
+		{"error", func(pi float64) (float64, error) { return 0, failing }, 0, true},
+		{"error inside the range", func(pi float64) (float64, error) {
+			if pi > 0 && pi < 0.3 {
+				return 0, failing
+			}
+			return pi - 0.1, nil
+		}, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := breakevenInflation(tt.diff)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Parámetros por defecto del árbol de /oas.
+const (
+	defaultTreeStepsPerYear = 24
+	minTreeSteps            = 30
+	maxTreeSteps            = 1000
+	defaultShiftBp          = 25.0
+)
+
+// treeCashflowFor lays the payments after settlementDate and the call and put amounts of the bond on a tree
+// of n steps up to its last payment. Dates are moved to the nearest step. It returns the horizon in years.
+func treeCashflowFor(flow []Flujo, rfs []redemptionFlow, settlementDate time.Time, n int) (treeCashflow, float64) {
+	var future []Flujo
+	for _, cf := range flow {
+		if cf.Date.After(settlementDate.Add(-24 * time.Hour)) { // como GenerateArrays
+			future = append(future, cf)
+		}
+	}
+	cf := newTreeCashflow(n)
+	if len(future) == 0 {
+		return cf, 0
+	}
+	years := func(d time.Time) float64 { return d.Sub(settlementDate).Hours() / 24 / 365 }
+	horizon := years(time.Time(future[len(future)-1].Date))
+	if horizon <= 0 {
+		cf.pay[0] = future[len(future)-1].Amount
+		return cf, 0
+	}
+	step := func(d time.Time) int {
+		i := int(math.Round(years(d) / horizon * float64(n)))
+		if i > n {
+			i = n
+		}
+		return i
+	}
+	for _, f := range future {
+		cf.pay[step(time.Time(f.Date))] += f.Amount
+	}
+	for _, rf := range rfs {
+		if rf.Kind == RedeemMaturity || rf.Date.After(time.Time(future[len(future)-1].Date)) {
+			continue
+		}
+		i := step(rf.Date)
+		amount := rf.flow[len(rf.flow)-1].Amount
+		switch rf.Kind {
+		case RedeemCall:
+			if math.IsNaN(cf.call[i]) || amount < cf.call[i] {
+				cf.call[i] = amount
+			}
+		case RedeemPut:
+			if math.IsNaN(cf.put[i]) || amount > cf.put[i] {
+				cf.put[i] = amount
+			}
+		}
+	}
+	return cf, horizon
+}
+
+// oasWrapper computes the option-adjusted spread of a bond at price: the spread over the short rates of a
+// Ho-Lee or BDT tree calibrated to the zero curve at which the bond, with its calls and puts, is worth price.
+// Effective duration and convexity reprice the bond at that spread with the curve shifted shiftBp up and down.
+func oasWrapper(c *gin.Context) {
+	ticker := strings.ToUpper(c.Query("ticker"))
+	price, err := strconv.ParseFloat(c.Query("price"), 64)
+	if err != nil || price <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "price should be a number greater than 0"})
+		return
+	}
+	curve, err := parseZeroCurve(c.Query("curve"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	model, err := normalizeModel(c.Query("model"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sigma := defaultHoLeeVolatility
+	if model == ModelBDT {
+		sigma = defaultBDTVolatility
+	}
+	if s := c.Query("volatility"); s != "" {
+		if sigma, err = strconv.ParseFloat(s, 64); err != nil || sigma < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "volatility should be a number greater or equal to 0"})
+			return
+		}
+	}
+	shiftBp := defaultShiftBp
+	if s := c.Query("shiftBp"); s != "" {
+		if shiftBp, err = strconv.ParseFloat(s, 64); err != nil || shiftBp <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "shiftBp should be a number greater than 0"})
+			return
+		}
+	}
+	extendIndex := 0.0
+	if s := c.Query("extendIndex"); s != "" {
+		if extendIndex, err = strconv.ParseFloat(s, 64); err != nil || extendIndex < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "extendIndex should be a number greater or equal to 0"})
+			return
+		}
+	}
+
+	bonds, err := bondsForRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	_, index, err := getCashFlow(bonds, ticker)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "ticker not found"})
+		return
+	}
+	b := bonds[index]
+	if b.isDual() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "dual bonds are not supported, use /price"})
+		return
+	}
+	md, err := marketDataForRequest(c)
+	if err != nil {
+		c.JSON(indexErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	settlementDate, err := settlementDateFromQuery(c, ticker, bonds, md)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	flow, err := md.cashflow(b)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	adj, err := md.indexRatio(b, settlementDate, extendIndex)
+	if err != nil {
+		c.JSON(indexErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	rfs, err := md.redemptionFlows(b, flow, settlementDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// el árbol trabaja con el precio sin ajustar, como Yield
+	last := time.Time(flow[len(flow)-1].Date)
+	steps := int(math.Ceil(last.Sub(settlementDate).Hours() / 24 / 365 * defaultTreeStepsPerYear))
+	if steps < minTreeSteps {
+		steps = minTreeSteps
+	}
+	if s := c.Query("steps"); s != "" {
+		if steps, err = strconv.Atoi(s); err != nil || steps < 1 || steps > maxTreeSteps {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "steps should be between 1 and " + strconv.Itoa(maxTreeSteps)})
+			return
+		}
+	}
+	if steps > maxTreeSteps {
+		steps = maxTreeSteps
+	}
+	_, entitled, err := md.entitlement(b, flow, settlementDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cf, horizon := treeCashflowFor(entitled, rfs, settlementDate, steps)
+	if horizon <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the bond has no payments after the settlement date"})
+		return
+	}
+	tree, err := newShortRateTree(model, curve, sigma, horizon, steps)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	target := price / adj.ratio
+	oas, err := tree.spreadFor(cf, target, true)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	zSpread, err := tree.spreadFor(cf, target, false)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	optionFree := tree.value(cf, oas, false)
+
+	shift := shiftBp / 10000
+	up, err := newShortRateTree(model, curve.shifted(shift), sigma, horizon, steps)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	down, err := newShortRateTree(model, curve.shifted(-shift), sigma, horizon, steps)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	pUp, pDown := up.value(cf, oas, true), down.value(cf, oas, true)
+
+	c.JSON(http.StatusOK, gin.H{
+		"Ticker":             ticker,
+		"SettlementDate":     Fecha(settlementDate),
+		"Price":              price,
+		"OAS":                oas,
+		"ZSpread":            zSpread, // same tree without the options
+		"OptionFreePrice":    optionFree * adj.ratio,
+		"OptionValue":        (optionFree - target) * adj.ratio, // > 0: the calls are worth more to the issuer than the puts to the holder
+		"EffectiveDuration":  (pDown - pUp) / (2 * target * shift),
+		"EffectiveConvexity": (pDown + pUp - 2*target) / (target * shift * shift),
+		"Model":              model,
+		"Volatility":         sigma,
+		"Steps":              steps,
+		"ShiftBp":            shiftBp,
+		"Maturity":           b.Maturity,
+		"MarketData":         md,
+	})
+}
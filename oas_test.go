@@ -0,0 +1,70 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"testing"
+)
+
+// tenPercentBond pays a 10% annual coupon for five years from 2024-01-02.
+func tenPercentBond(ticker string) Bond {
+	b := Bond{
+		ID: ticker, Ticker: ticker, IssueDate: Fecha(mustDate("2024-01-02")), Maturity: Fecha(mustDate("2029-01-02")),
+		Coupon: 0.1, Currency: "USD", Issuer: "corporate",
+	}
+	for _, d := range []string{"2025-01-02", "2026-01-02", "2027-01-02", "2028-01-02", "2029-01-02"} {
+		b.Cashflow = append(b.Cashflow, Flujo{Date: Fecha(mustDate(d)), Rate: 0.1, Residual: 100, Amount: 10})
+	}
+	last := &b.Cashflow[len(b.Cashflow)-1]
+	last.Amort, last.Residual, last.Amount = 100, 0, 110
+	return b
+}
+
+func TestOAS(t *testing.T) {
+	plain := tenPercentBond("PLN")
+	callable := tenPercentBond("CLL")
+	callable.Calls = []Redemption{{Date: Fecha(mustDate("2026-01-02")), Price: 100}, {Date: Fecha(mustDate("2027-01-02")), Price: 100}}
+	putable := tenPercentBond("PUT")
+	putable.Puts = []Redemption{{Date: Fecha(mustDate("2026-01-02")), Price: 100}, {Date: Fecha(mustDate("2027-01-02")), Price: 100}}
+	setTestMarket(t, []Bond{plain, callable, putable}, nil, nil)
+
+	tests := []struct {
+		name          string
+		ticker        string
+		price         string
+		curve         string // the call is in the money with low rates and the put with high ones
+		model         string
+		cmp           int // sign of OAS - ZSpread
+		convexitySign int
+	}{
+		{"plain Ho-Lee", "PLN", "115", "1:0.05", "holee", 0, 1},
+		{"plain BDT", "PLN", "85", "1:0.15", "bdt", 0, 1},
+		{"callable Ho-Lee", "CLL", "105", "1:0.05", "holee", -1, -1},
+		{"callable BDT", "CLL", "105", "1:0.05", "bdt", -1, -1},
+		{"putable Ho-Lee", "PUT", "95", "1:0.15", "holee", 1, 1},
+		{"putable BDT", "PUT", "95", "1:0.15", "bdt", 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, out := getJSON(t, oasWrapper, "/oas?ticker="+tt.ticker+"&settlementDate=2024-01-02&price="+tt.price+"&curve="+tt.curve+"&model="+tt.model)
+			if code != http.StatusOK {
+				t.Fatalf("%d %v", code, out)
+			}
+			oas, z := out["OAS"].(float64), out["ZSpread"].(float64)
+			switch {
+			case tt.cmp == 0 && math.Abs(oas-z) > 1e-9:
+				t.Errorf("OAS %v, want the Z-spread %v", oas, z)
+			case tt.cmp < 0 && oas >= z:
+				t.Errorf("OAS %v, want below the Z-spread %v", oas, z)
+			case tt.cmp > 0 && oas <= z:
+				t.Errorf("OAS %v, want above the Z-spread %v", oas, z)
+			}
+			if d := out["EffectiveDuration"].(float64); d <= 0 {
+				t.Errorf("effective duration %v, want > 0", d)
+			}
+			if c := out["EffectiveConvexity"].(float64); c*float64(tt.convexitySign) <= 0 {
+				t.Errorf("effective convexity %v, want sign %d", c, tt.convexitySign)
+			}
+		})
+	}
+}
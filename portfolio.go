@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PortfoliosFile is the path of the json holding the portfolios, unless PORTFOLIOS_PATH is set.
+const PortfoliosFile = "./portfolios.json"
+
+// Position is a holding of a bond: Nominal of original face value bought for Cost, the total amount paid in the
+// bond's currency (e.g. the Total of /ticket). Price, PriceType and Currency are optional and override the
+// price of the request and the bond's PriceType and Currency.
+type Position struct {
+	Ticker    string
+	Nominal   float64
+	Cost      float64
+	Price     float64 `json:",omitempty"`
+	PriceType string  `json:",omitempty"`
+	Currency  string  `json:",omitempty"`
+}
+
+// Portfolio is a named list of positions.
+type Portfolio struct {
+	Name      string
+	Positions []Position
+}
+
+// validatePositions checks the positions against the bonds: known tickers, positive nominals and valid price types.
+func validatePositions(positions []Position, bonds []Bond) error {
+	if len(positions) == 0 {
+		return errors.New("the portfolio has no positions")
+	}
+	var problems []string
+	for i, p := range positions {
+		name := p.Ticker
+		if name == "" {
+			name = fmt.Sprintf("position #%d", i+1)
+		}
+		if _, _, err := getCashFlow(bonds, p.Ticker); err != nil {
+			problems = append(problems, name+": ticker not found")
+		}
+		if p.Nominal <= 0 {
+			problems = append(problems, name+": nominal should be greater than 0")
+		}
+		if p.Cost < 0 || p.Price < 0 {
+			problems = append(problems, name+": cost and price should not be negative")
+		}
+		if _, err := normalizePriceType(p.PriceType); err != nil {
+			problems = append(problems, name+": "+err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// normalizePositions uppercases tickers and currencies.
+func normalizePositions(positions []Position) {
+	for i := range positions {
+		positions[i].Ticker = strings.ToUpper(strings.TrimSpace(positions[i].Ticker))
+		positions[i].Currency = strings.ToUpper(strings.TrimSpace(positions[i].Currency))
+	}
+}
+
+// portfolioStore keeps the portfolios in a single json file, written atomically on every change.
+type portfolioStore struct {
+	*namedStore
+}
+
+var portfolios = &portfolioStore{newNamedStore("PORTFOLIOS_PATH", PortfoliosFile)}
+
+func (s *portfolioStore) List() ([]Portfolio, error) {
+	list := []Portfolio{}
+	if err := s.list(&list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Get returns the portfolio called name, or false if there is none.
+func (s *portfolioStore) Get(name string) (Portfolio, bool, error) {
+	var p Portfolio
+	ok, err := s.get(name, &p)
+	return p, ok, err
+}
+
+// Save adds the portfolio or replaces the one with the same name.
+func (s *portfolioStore) Save(p Portfolio) error {
+	return s.save(p.Name, p)
+}
+
+func listPortfoliosWrapper(c *gin.Context) {
+	list, err := portfolios.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func getPortfolioWrapper(c *gin.Context) {
+	p, ok, err := portfolios.Get(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	} else if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "portfolio not found"})
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+// savePortfolioWrapper stores the positions of the body ({"Positions": [...]}) under the name of the path.
+func savePortfolioWrapper(c *gin.Context) {
+	var p Portfolio
+	if err := c.ShouldBindJSON(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	p.Name = c.Param("name")
+	normalizePositions(p.Positions)
+	if err := validatePositions(p.Positions, currentBonds()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := portfolios.Save(p); err != nil {
+		fmt.Println("Error when saving portfolio:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+func deletePortfolioWrapper(c *gin.Context) {
+	ok, err := portfolios.Delete(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	} else if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "portfolio not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"Result": "Portfolio deleted", "Name": c.Param("name")})
+}
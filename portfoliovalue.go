@@ -0,0 +1,402 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Buckets of years to maturity for the exposure of a portfolio.
+var maturityBuckets = []struct {
+	name string
+	upTo float64
+}{
+	{"0-1y", 1},
+	{"1-3y", 3},
+	{"3-5y", 5},
+	{"5-10y", 10},
+	{"10y+", math.Inf(1)},
+}
+
+func maturityBucket(years float64) string {
+	for _, b := range maturityBuckets {
+		if years < b.upTo {
+			return b.name
+		}
+	}
+	return maturityBuckets[len(maturityBuckets)-1].name
+}
+
+// positionValue is a position valued on the settlement date. Prices are per 100 of original face value
+// and index adjusted; MarketValue and Cost are in the bond's currency, MarketValueBase and DV01 in the base currency.
+type positionValue struct {
+	Ticker          string
+	Currency        string
+	Index           string
+	Nominal         float64
+	PriceType       string
+	SettlementDate  Fecha // on the bond's settlement calendar
+	CleanPrice      float64
+	DirtyPrice      float64
+	AccruedInterest float64
+	TechnicalValue  float64
+	Parity          float64
+	MarketValue     float64
+	MarketValueBase float64
+	Cost            float64
+	PnL             float64 // MarketValue - Cost
+	Yield           float64
+	MDuration       float64
+	Convexity       float64
+	DV01            float64 // change in market value for 1bp of yield
+	Maturity        Fecha
+	YearsToMaturity float64
+	Bucket          string
+	Weight          float64
+	fx              float64 // units of the base currency per unit of Currency
+}
+
+// portfolioBucket aggregates positions in the base currency. Yield, MDuration and Convexity are weighted by market value.
+type portfolioBucket struct {
+	Name        string `json:",omitempty"`
+	MarketValue float64
+	Weight      float64 // share of the market value of the portfolio
+	Yield       float64
+	MDuration   float64
+	Convexity   float64
+	DV01        float64
+	Positions   int
+}
+
+func (b *portfolioBucket) add(p positionValue) {
+	b.MarketValue += p.MarketValueBase
+	b.Yield += p.Yield * p.MarketValueBase
+	b.MDuration += p.MDuration * p.MarketValueBase
+	b.Convexity += p.Convexity * p.MarketValueBase
+	b.DV01 += p.DV01
+	b.Positions++
+}
+
+func (b *portfolioBucket) finish(total float64) {
+	if b.MarketValue != 0 {
+		b.Yield /= b.MarketValue
+		b.MDuration /= b.MarketValue
+		b.Convexity /= b.MarketValue
+	}
+	if total != 0 {
+		b.Weight = b.MarketValue / total
+	}
+}
+
+// parseKeyValues reads "KEY:value,KEY:value" as used by the prices and fx params. Keys are uppercased.
+// With positive the values must be greater than 0.
+func parseKeyValues(s string, param string, positive bool) (map[string]float64, error) {
+	out := map[string]float64{}
+	if strings.TrimSpace(s) == "" {
+		return out, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid %s %q, use KEY:value", param, part)
+		}
+		v, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q, the value should be a number", param, part)
+		}
+		if positive && v <= 0 {
+			return nil, fmt.Errorf("invalid %s %q, the value should be a number greater than 0", param, part)
+		}
+		out[strings.ToUpper(strings.TrimSpace(kv[0]))] = v
+	}
+	return out, nil
+}
+
+// portfolioCurrencies sets the currency of each position, its own or its bond's, and returns the currencies in the portfolio.
+func portfolioCurrencies(positions []Position, bonds []Bond) []string {
+	seen := map[string]bool{}
+	var out []string
+	for i, pos := range positions {
+		if pos.Currency == "" {
+			_, index, _ := getCashFlow(bonds, pos.Ticker)
+			positions[i].Currency = strings.ToUpper(bonds[index].Currency)
+		}
+		if !seen[positions[i].Currency] {
+			seen[positions[i].Currency] = true
+			out = append(out, positions[i].Currency)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// validCurrency reports whether cur is a three letter currency code.
+func validCurrency(cur string) bool {
+	if len(cur) != 3 {
+		return false
+	}
+	for _, r := range cur {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// fxRate returns the units of base per unit of cur, from the fx param. A position without currency is an error,
+// even against an empty base, so amounts in different currencies are never added as if they were the same.
+func fxRate(cur string, base string, fx map[string]float64, ticker string) (float64, error) {
+	if cur == "" {
+		return 0, fmt.Errorf("%s: the currency is not set, add Currency to the bond or the position", ticker)
+	}
+	if cur == base {
+		return 1, nil
+	}
+	if r, ok := fx[cur]; ok {
+		return r, nil
+	}
+	return 0, fmt.Errorf("%s: fx rate for %s is required, as fx=%s:rate in %s", ticker, cur, cur, base)
+}
+
+// valuePosition values one position at a price of priceType per 100 of original face value, as /yield does.
+func valuePosition(md *marketData, b Bond, pos Position, price float64, priceType string, settlementDate time.Time, extendIndex float64) (positionValue, error) {
+	pv := positionValue{Ticker: b.Ticker, Index: b.Index, Nominal: pos.Nominal, PriceType: priceType, SettlementDate: Fecha(settlementDate), Cost: pos.Cost, Maturity: b.Maturity}
+	if pv.Index == "" {
+		pv.Index = "none"
+	}
+	flow, err := md.cashflow(b)
+	if err != nil {
+		return pv, err
+	}
+	adj, err := md.indexRatio(b, settlementDate, extendIndex)
+	if err != nil {
+		return pv, err
+	}
+	face, entitled, err := md.entitlement(b, flow, settlementDate)
+	if err != nil {
+		return pv, err
+	}
+	info := extendedInfo(face, &price, adj.ratio)
+	dirty := toDirty(price, priceType, info.accInt)
+	info = extendedInfo(face, &dirty, adj.ratio)
+
+	unadjusted := dirty / adj.ratio
+	y, err, _ := Yield(entitled, unadjusted, settlementDate, 0, 0)
+	if err != nil {
+		return pv, fmt.Errorf("yield: %w", err)
+	}
+	mduration, err := Mduration(entitled, y, settlementDate, 0, 0, unadjusted)
+	if err != nil {
+		return pv, fmt.Errorf("modified duration: %w", err)
+	}
+	convexity, err := Convexity(entitled, y, settlementDate, 0, 0, unadjusted)
+	if err != nil {
+		return pv, fmt.Errorf("convexity: %w", err)
+	}
+
+	pv.DirtyPrice = dirty
+	pv.CleanPrice = dirty - info.accInt
+	pv.AccruedInterest = info.accInt
+	pv.TechnicalValue, pv.Parity = info.techValue, info.parity
+	pv.MarketValue = pos.Nominal / 100 * dirty
+	if pos.Cost > 0 {
+		pv.PnL = pv.MarketValue - pos.Cost
+	}
+	pv.Yield, pv.MDuration, pv.Convexity = y, mduration, convexity
+	pv.YearsToMaturity = time.Time(b.Maturity).Sub(settlementDate).Hours() / 24 / 365
+	pv.Bucket = maturityBucket(pv.YearsToMaturity)
+	return pv, nil
+}
+
+// portfolioValuation is the valuation of the positions of a request, shared by the portfolio value and the scenarios.
+type portfolioValuation struct {
+	bonds          []Bond
+	md             *marketData
+	settlementDate time.Time // of the AR bonds, each position settles on its bond's calendar
+	base           string
+	extendIndex    float64
+	values         []positionValue // one per position, in the same order
+}
+
+// valuePositions values every position at the price of the prices param (TICKER:price) or, failing that, its own Price,
+// with the bonds and market data of the request, settling the trade date of each on its bond's calendar (a NY bond needs
+// both markets open), and converts it to the base currency with the fx param.
+// Errors are bad requests unless they are errDataUnavailable, see indexErrorStatus.
+func valuePositions(c *gin.Context, positions []Position) (*portfolioValuation, error) {
+	prices, err := parseKeyValues(c.Query("prices"), "price", true)
+	if err != nil {
+		return nil, err
+	}
+	fx, err := parseKeyValues(c.Query("fx"), "fx", true)
+	if err != nil {
+		return nil, err
+	}
+	v := &portfolioValuation{}
+	if s := c.Query("extendIndex"); s != "" {
+		if v.extendIndex, err = strconv.ParseFloat(s, 64); err != nil || v.extendIndex < 0 {
+			return nil, errors.New("extendIndex should be a number greater or equal to 0")
+		}
+	}
+	if v.bonds, err = bondsForRequest(c); err != nil {
+		return nil, err
+	}
+	normalizePositions(positions)
+	if err := validatePositions(positions, v.bonds); err != nil {
+		return nil, err
+	}
+	if v.md, err = marketDataForRequest(c); err != nil {
+		return nil, err
+	}
+	if v.settlementDate, err = settlementDateFromQuery(c, "", v.bonds, v.md); err != nil {
+		return nil, err
+	}
+
+	currencies := portfolioCurrencies(positions, v.bonds)
+	v.base = strings.ToUpper(c.Query("baseCurrency"))
+	if v.base == "" {
+		if len(currencies) > 1 {
+			return nil, errors.New("baseCurrency is required for a portfolio in more than one currency")
+		}
+		v.base = currencies[0]
+	}
+
+	for _, pos := range positions {
+		_, index, _ := getCashFlow(v.bonds, pos.Ticker)
+		b := v.bonds[index]
+		if b.isDual() {
+			return nil, errors.New(pos.Ticker + ": dual bonds are not supported")
+		}
+		price, ok := prices[pos.Ticker]
+		if !ok {
+			price = pos.Price
+		}
+		if price <= 0 {
+			return nil, errors.New(pos.Ticker + ": price is required, as prices=" + pos.Ticker + ":price or in the position")
+		}
+		priceType, err := priceTypeFor(b, pos.PriceType)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", pos.Ticker, err)
+		}
+		rate, err := fxRate(pos.Currency, v.base, fx, pos.Ticker)
+		if err != nil {
+			return nil, err
+		}
+		settle, err := settlementDateFromQuery(c, pos.Ticker, v.bonds, v.md)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", pos.Ticker, err)
+		}
+		pv, err := valuePosition(v.md, b, pos, price, priceType, settle, v.extendIndex)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", pos.Ticker, err)
+		}
+		pv.Currency, pv.fx = pos.Currency, rate
+		pv.MarketValueBase = pv.MarketValue * rate
+		pv.DV01 = pv.MDuration * pv.MarketValueBase * 0.0001
+		v.values = append(v.values, pv)
+	}
+	return v, nil
+}
+
+// valuePortfolio values the positions as valuePositions and aggregates them in the base currency: in total, by currency,
+// by index and by maturity bucket.
+func valuePortfolio(c *gin.Context, name string, positions []Position) {
+	v, err := valuePositions(c, positions)
+	if err != nil {
+		c.JSON(indexErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	values := v.values
+
+	total := portfolioBucket{}
+	byCurrency := map[string]*portfolioBucket{}
+	byIndex := map[string]*portfolioBucket{}
+	byMaturity := map[string]*portfolioBucket{}
+	localValue := map[string]float64{}
+	cost, pnl := 0.0, 0.0
+	for _, pv := range values {
+		total.add(pv)
+		for _, group := range []struct {
+			m   map[string]*portfolioBucket
+			key string
+		}{{byCurrency, pv.Currency}, {byIndex, pv.Index}, {byMaturity, pv.Bucket}} {
+			if group.m[group.key] == nil {
+				group.m[group.key] = &portfolioBucket{Name: group.key}
+			}
+			group.m[group.key].add(pv)
+		}
+		localValue[pv.Currency] += pv.MarketValue
+		cost += pv.Cost * pv.fx
+		pnl += pv.PnL * pv.fx
+	}
+	total.finish(total.MarketValue)
+	for i := range values {
+		if total.MarketValue != 0 {
+			values[i].Weight = values[i].MarketValueBase / total.MarketValue
+		}
+	}
+	buckets := func(m map[string]*portfolioBucket) []*portfolioBucket {
+		out := []*portfolioBucket{}
+		for _, b := range m {
+			b.finish(total.MarketValue)
+			out = append(out, b)
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+		return out
+	}
+	maturities := []*portfolioBucket{}
+	for _, mb := range maturityBuckets {
+		if b := byMaturity[mb.name]; b != nil {
+			b.finish(total.MarketValue)
+			maturities = append(maturities, b)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Name":                  name,
+		"SettlementDate":        Fecha(v.settlementDate),
+		"BaseCurrency":          v.base,
+		"MarketValue":           total.MarketValue,
+		"Cost":                  cost,
+		"PnL":                   pnl,
+		"Yield":                 total.Yield,
+		"MDuration":             total.MDuration,
+		"Convexity":             total.Convexity,
+		"DV01":                  total.DV01,
+		"MarketValueByCurrency": localValue,
+		"ByCurrency":            buckets(byCurrency),
+		"ByIndex":               buckets(byIndex),
+		"ByMaturity":            maturities,
+		"Positions":             values,
+		"MarketData":            v.md,
+	})
+}
+
+// portfolioValueWrapper values a stored portfolio.
+func portfolioValueWrapper(c *gin.Context) {
+	p, ok, err := portfolios.Get(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	} else if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "portfolio not found"})
+		return
+	}
+	valuePortfolio(c, p.Name, p.Positions)
+}
+
+// adhocPortfolioValueWrapper values the positions of the body ({"Positions": [...]}) without storing them.
+func adhocPortfolioValueWrapper(c *gin.Context) {
+	var p Portfolio
+	if err := c.ShouldBindJSON(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	valuePortfolio(c, p.Name, p.Positions)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestValuePosition(t *testing.T) {
+	md := &marketData{calendars: buildCalendars(nil), gapPolicy: GapError}
+	b := tenPercentBond("PLN")
+	settle := mustDate("2025-07-02")
+	// 181 días de cupón corrido sobre 100 al 10%
+	accrued := 0.1 * 100 * 181 / 360
+	tests := []struct {
+		name      string
+		price     float64
+		priceType string
+		pos       Position
+		dirty     float64
+		minYield  float64
+		maxYield  float64
+	}{
+		{"clean at par", 100, PriceClean, Position{Ticker: "PLN", Nominal: 1000, Cost: 1000}, 100 + accrued, 0.095, 0.105},
+		{"dirty price", 100 + accrued, PriceDirty, Position{Ticker: "PLN", Nominal: 1000}, 100 + accrued, 0.095, 0.105},
+		{"below par yields more", 90, PriceClean, Position{Ticker: "PLN", Nominal: 500, Cost: 480}, 90 + accrued, 0.12, 0.14},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pv, err := valuePosition(md, b, tt.pos, tt.price, tt.priceType, settle, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(pv.DirtyPrice-tt.dirty) > 1e-9 || math.Abs(pv.AccruedInterest-accrued) > 1e-9 || math.Abs(pv.CleanPrice+pv.AccruedInterest-pv.DirtyPrice) > 1e-9 {
+				t.Errorf("clean %v dirty %v accrued %v, want dirty %v accrued %v", pv.CleanPrice, pv.DirtyPrice, pv.AccruedInterest, tt.dirty, accrued)
+			}
+			if math.Abs(pv.Parity-pv.DirtyPrice/pv.TechnicalValue*100) > 1e-9 || math.Abs(pv.TechnicalValue-(100+accrued)) > 1e-9 {
+				t.Errorf("technical value %v parity %v", pv.TechnicalValue, pv.Parity)
+			}
+			if want := tt.pos.Nominal / 100 * tt.dirty; math.Abs(pv.MarketValue-want) > 1e-9 {
+				t.Errorf("market value %v, want %v", pv.MarketValue, want)
+			}
+			wantPnL := 0.0 // sin costo no hay PnL
+			if tt.pos.Cost > 0 {
+				wantPnL = pv.MarketValue - tt.pos.Cost
+			}
+			if math.Abs(pv.PnL-wantPnL) > 1e-9 {
+				t.Errorf("PnL %v, want %v", pv.PnL, wantPnL)
+			}
+			if pv.Yield < tt.minYield || pv.Yield > tt.maxYield {
+				t.Errorf("yield %v, want between %v and %v", pv.Yield, tt.minYield, tt.maxYield)
+			}
+			if pv.MDuration <= 0 || pv.MDuration > 3.5 || pv.Convexity <= 0 {
+				t.Errorf("mduration %v convexity %v", pv.MDuration, pv.Convexity)
+			}
+			if pv.Bucket != "3-5y" || pv.SettlementDate.Format(DateFormat) != "2025-07-02" || pv.Index != "none" {
+				t.Errorf("bucket %s settlement %s index %s", pv.Bucket, pv.SettlementDate.Format(DateFormat), pv.Index)
+			}
+		})
+	}
+
+	bad := b
+	bad.Roll = "nearest"
+	if _, err := valuePosition(md, bad, Position{Ticker: "PLN", Nominal: 100}, 100, PriceClean, settle, 0); err == nil {
+		t.Error("bad roll: want an error")
+	}
+}
+
+// Each position settles the trade date on its bond's calendar: the NY bond skips Juneteenth and the Argentine holidays.
+func TestValuePositionsSettlesOnBondCalendar(t *testing.T) {
+	ny := tenPercentBond("GDX")
+	ny.Calendar = "NY"
+	setTestMarket(t, []Bond{tenPercentBond("ALX"), ny}, nil, arHolidays2024)
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		query string
+		want  map[string]string
+	}{
+		{"?tradeDate=2024-06-18&prices=ALX:100,GDX:100", map[string]string{"ALX": "2024-06-19", "GDX": "2024-06-24"}},
+		{"?tradeDate=2024-06-18&settlementTerm=CI&prices=ALX:100,GDX:100", map[string]string{"ALX": "2024-06-18", "GDX": "2024-06-18"}},
+		{"?settlementDate=2024-06-20&prices=ALX:100,GDX:100", map[string]string{"ALX": "2024-06-20", "GDX": "2024-06-20"}},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/portfolios/value"+tt.query, nil)
+		v, err := valuePositions(c, []Position{{Ticker: "ALX", Nominal: 100}, {Ticker: "GDX", Nominal: 100}})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		for _, pv := range v.values {
+			if got := pv.SettlementDate.Format(DateFormat); got != tt.want[pv.Ticker] {
+				t.Errorf("%s: %s settles on %s, want %s", tt.query, pv.Ticker, got, tt.want[pv.Ticker])
+			}
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Price of a PriceRecord used by the yield series.
+const (
+	PriceFieldClose = "close"
+	PriceFieldBid   = "bid"
+	PriceFieldAsk   = "ask"
+	PriceFieldMid   = "mid"
+)
+
+// price returns the field of r, 0 if it is missing. mid is the average of bid and ask.
+func (r PriceRecord) price(field string) float64 {
+	switch field {
+	case PriceFieldBid:
+		return r.Bid
+	case PriceFieldAsk:
+		return r.Ask
+	case PriceFieldMid:
+		if r.Bid > 0 && r.Ask > 0 {
+			return (r.Bid + r.Ask) / 2
+		}
+		return 0
+	}
+	return r.Close
+}
+
+// yieldPoint is the valuation of a stored price. Prices are per 100 of original face value.
+type yieldPoint struct {
+	Date            Fecha
+	SettlementDate  Fecha
+	Price           float64
+	CleanPrice      float64
+	DirtyPrice      float64
+	AccruedInterest float64
+	TechnicalValue  float64
+	Parity          float64
+	Yield           float64
+	MDuration       float64
+	IndexRatio      float64 `json:",omitempty"`
+	Extrapolated    bool    `json:",omitempty"` // the index of the settlement date was not published yet
+	AsOf            *Fecha  `json:",omitempty"` // snapshot the point was valued with, with pointInTime
+	CurrentData     bool    `json:",omitempty"` // valued with the current data: no snapshot was known at that date
+	Error           string  `json:",omitempty"`
+}
+
+// yieldHistoryWrapper values the stored prices of a ticker between from and to: yield, modified duration, parity and
+// technical value at each date, settling the trade date with settlementTerm (T+1 by default).
+// By default every date is valued with the index and holidays of the snapshots known at the end of that day; the dates
+// before the first snapshot are valued with the current ones and flagged CurrentData. With pointInTime=false, asOf or
+// the snapshots disabled the whole series is valued with the current data (or asOf).
+// A date that can't be valued keeps its Error and the series goes on.
+func yieldHistoryWrapper(c *gin.Context) {
+	ticker := strings.ToUpper(c.Param("ticker"))
+	from, to, err := priceRangeFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	term, err := parseSettlementTerm(c.DefaultQuery("settlementTerm", "T+1"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	field := strings.ToLower(c.DefaultQuery("field", PriceFieldClose))
+	switch field {
+	case PriceFieldClose, PriceFieldBid, PriceFieldAsk, PriceFieldMid:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown field " + field + ", use close, bid, ask or mid"})
+		return
+	}
+	pointInTime := snapshots != nil && c.Query("asOf") == ""
+	if s := c.Query("pointInTime"); s != "" {
+		if pointInTime, err = strconv.ParseBool(s); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "pointInTime should be true or false"})
+			return
+		}
+		if pointInTime && snapshots == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "pointInTime needs the snapshots, which are disabled"})
+			return
+		}
+		if pointInTime && c.Query("asOf") != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "use either pointInTime or asOf"})
+			return
+		}
+	}
+	extendIndex := 0.0
+	if s := c.Query("extendIndex"); s != "" {
+		if extendIndex, err = strconv.ParseFloat(s, 64); err != nil || extendIndex < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "extendIndex should be a number greater or equal to 0"})
+			return
+		}
+	}
+	bonds, err := bondsForRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	_, index, err := getCashFlow(bonds, ticker)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "ticker not found"})
+		return
+	}
+	b := bonds[index]
+	if b.isDual() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ticker + ": dual bonds are not supported"})
+		return
+	}
+	priceType, err := priceTypeFor(b, c.Query("priceType"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	calendarName, err := settlementCalendar(b.Calendar)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	md, err := marketDataForRequest(c)
+	if err != nil {
+		c.JSON(indexErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	records, err := prices.Series(c.Request.Context(), ticker, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// los puntos que caen en los mismos snapshots se valúan con el mismo marketData, que se carga una sola vez
+	var files snapshotFiles
+	if pointInTime {
+		if files, err = snapshots.List(append([]string{snapshotHolidays}, indexNames...)...); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	var lastKey string
+	var lastMD *marketData
+	var lastErr error
+	usedCurrent := !pointInTime
+
+	points := []yieldPoint{}
+	for _, r := range records {
+		p := yieldPoint{Date: r.Date, Price: r.price(field)}
+		points = append(points, p)
+		pt := &points[len(points)-1]
+		valueWith := md
+		if pointInTime {
+			// lo que se conocía al cierre del día de la operación
+			asOf := time.Time(r.Date).Add(24*time.Hour - time.Nanosecond)
+			if snapshotFileAsOf(files[snapshotHolidays], snapshotHolidays, asOf) == "" {
+				// antes del primer snapshot no hay otra cosa que los datos actuales: se usan y se marca el punto
+				pt.CurrentData = true
+				usedCurrent = true
+			} else {
+				if key := files.key(asOf); key != lastKey {
+					if lastMD, lastErr = marketDataAsOf(asOf); lastErr == nil {
+						lastMD.gapPolicy = md.gapPolicy
+					}
+					lastKey = key
+				}
+				if lastErr != nil {
+					pt.Error = lastErr.Error()
+					continue
+				}
+				valueWith = lastMD
+				d := Fecha(asOf)
+				pt.AsOf = &d
+			}
+		}
+		// se liquida con los feriados con los que se valúa
+		settle, err := valueWith.settlementDate(time.Time(r.Date), term, calendarName)
+		if err != nil {
+			pt.Error = err.Error()
+			continue
+		}
+		pt.SettlementDate = Fecha(settle)
+		if p.Price <= 0 {
+			pt.Error = "no " + field + " price"
+			continue
+		}
+		if time.Time(b.Maturity).Before(settle) {
+			pt.Error = "the bond matured before the settlement date"
+			continue
+		}
+		pv, err := valuePosition(valueWith, b, Position{Ticker: ticker, Nominal: 100}, p.Price, priceType, settle, extendIndex)
+		if err != nil {
+			pt.Error = err.Error()
+			continue
+		}
+		pt.CleanPrice, pt.DirtyPrice, pt.AccruedInterest = pv.CleanPrice, pv.DirtyPrice, pv.AccruedInterest
+		pt.TechnicalValue, pt.Parity = pv.TechnicalValue, pv.Parity
+		pt.Yield, pt.MDuration = pv.Yield, pv.MDuration
+		if b.Index != "" {
+			if adj, err := valueWith.indexRatio(b, settle, extendIndex); err == nil {
+				pt.IndexRatio, pt.Extrapolated = adj.ratio, adj.extrapolated
+			}
+		}
+	}
+
+	if strings.EqualFold(c.Query("format"), "csv") {
+		var buffer bytes.Buffer
+		writer := csv.NewWriter(&buffer)
+		writer.Write([]string{"date", "settlementDate", "price", "cleanPrice", "dirtyPrice", "accruedInterest", "technicalValue", "parity", "yield", "mduration", "indexRatio", "extrapolated", "currentData", "error"})
+		f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+		for _, p := range points {
+			writer.Write([]string{
+				p.Date.Format(DateFormat), p.SettlementDate.Format(DateFormat), f(p.Price), f(p.CleanPrice), f(p.DirtyPrice), f(p.AccruedInterest),
+				f(p.TechnicalValue), f(p.Parity), f(p.Yield), f(p.MDuration), f(p.IndexRatio), strconv.FormatBool(p.Extrapolated), strconv.FormatBool(p.CurrentData), p.Error,
+			})
+		}
+		writer.Flush()
+		c.Header("Content-Disposition", fmt.Sprintf("attachment;filename=%s_yields.csv", ticker))
+		c.Data(http.StatusOK, "text/csv", buffer.Bytes())
+		return
+	}
+
+	out := gin.H{
+		"Ticker":         ticker,
+		"PriceType":      priceType,
+		"Field":          field,
+		"SettlementTerm": term,
+		"Points":         points,
+	}
+	if usedCurrent {
+		out["MarketData"] = md
+	}
+	c.JSON(http.StatusOK, out)
+}
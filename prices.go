@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PriceRecord is the market price of a ticker on a trade date, per 100 of original face value in the bond's price type.
+type PriceRecord struct {
+	Ticker string
+	Date   Fecha
+	Close  float64
+	Bid    float64 `json:",omitempty"`
+	Ask    float64 `json:",omitempty"`
+	Volume float64 `json:",omitempty"`
+}
+
+// priceStore keeps the prices in the bond_prices table of Postgres (POSTGRES_* variables), one row per ticker and date.
+type priceStore struct {
+	pool pgPool
+}
+
+const bondPricesDDL = `CREATE TABLE IF NOT EXISTS bond_prices (
+	ticker TEXT NOT NULL,
+	date   DATE NOT NULL,
+	close  DOUBLE PRECISION NOT NULL,
+	bid    DOUBLE PRECISION NOT NULL DEFAULT 0,
+	ask    DOUBLE PRECISION NOT NULL DEFAULT 0,
+	volume DOUBLE PRECISION NOT NULL DEFAULT 0,
+	PRIMARY KEY (ticker, date)
+)`
+
+var prices = &priceStore{pool: pgPool{ddl: []string{bondPricesDDL}}}
+
+// Upsert adds the records, replacing the ones of the same ticker and date, and returns how many were new and replaced.
+// It is all or nothing.
+func (s *priceStore) Upsert(ctx context.Context, records []PriceRecord) (int, int, error) {
+	if len(records) == 0 {
+		return 0, 0, nil
+	}
+	db, err := s.pool.open(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("begin import: %w", err)
+	}
+	defer tx.Rollback()
+	inserted, updated := 0, 0
+	for _, r := range records {
+		// xmax es 0 en una fila recién insertada y distinto de 0 en una actualizada
+		var isNew bool
+		err := tx.QueryRowContext(ctx,
+			`INSERT INTO bond_prices (ticker, date, close, bid, ask, volume) VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (ticker, date) DO UPDATE SET close = EXCLUDED.close, bid = EXCLUDED.bid, ask = EXCLUDED.ask, volume = EXCLUDED.volume
+			RETURNING xmax = 0`,
+			r.Ticker, time.Time(r.Date), r.Close, r.Bid, r.Ask, r.Volume).Scan(&isNew)
+		if err != nil {
+			return 0, 0, fmt.Errorf("insert price of %s on %s: %w", r.Ticker, r.Date.Format(DateFormat), err)
+		}
+		if isNew {
+			inserted++
+		} else {
+			updated++
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("commit import: %w", err)
+	}
+	return inserted, updated, nil
+}
+
+// Series returns the prices of ticker between from and to, both included, sorted by date.
+func (s *priceStore) Series(ctx context.Context, ticker string, from time.Time, to time.Time) ([]PriceRecord, error) {
+	db, err := s.pool.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx,
+		`SELECT ticker, date, close, bid, ask, volume FROM bond_prices WHERE ticker = $1 AND date BETWEEN $2 AND $3 ORDER BY date`,
+		ticker, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("query bond_prices: %w", err)
+	}
+	defer rows.Close()
+
+	out := []PriceRecord{}
+	for rows.Next() {
+		var r PriceRecord
+		var d time.Time
+		if err := rows.Scan(&r.Ticker, &d, &r.Close, &r.Bid, &r.Ask, &r.Volume); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		r.Date = Fecha(time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, time.UTC))
+		out = append(out, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+	return out, nil
+}
+
+// Delete removes the prices of ticker between from and to, both included, and returns how many there were.
+func (s *priceStore) Delete(ctx context.Context, ticker string, from time.Time, to time.Time) (int, error) {
+	db, err := s.pool.open(ctx)
+	if err != nil {
+		return 0, err
+	}
+	res, err := db.ExecContext(ctx, `DELETE FROM bond_prices WHERE ticker = $1 AND date BETWEEN $2 AND $3`, ticker, from, to)
+	if err != nil {
+		return 0, fmt.Errorf("delete prices: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("delete prices: %w", err)
+	}
+	return int(n), nil
+}
+
+// Tickers returns the tickers with prices and how many each one has.
+func (s *priceStore) Tickers(ctx context.Context) (map[string]int, error) {
+	db, err := s.pool.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, `SELECT ticker, count(*) FROM bond_prices GROUP BY ticker`)
+	if err != nil {
+		return nil, fmt.Errorf("query bond_prices: %w", err)
+	}
+	defer rows.Close()
+
+	out := map[string]int{}
+	for rows.Next() {
+		var ticker string
+		var n int
+		if err := rows.Scan(&ticker, &n); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		out[ticker] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+	return out, nil
+}
+
+// parsePricesCSV reads prices from a csv with a header row. The columns are ticker, date, close, bid, ask and volume,
+// in any order: date and close are required, and ticker unless defaultTicker is given. Every bad row is reported,
+// with its line number, and then nothing is returned.
+func parsePricesCSV(r io.Reader, defaultTicker string) ([]PriceRecord, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("empty csv")
+	} else if err != nil {
+		return nil, err
+	}
+	cols := map[string]int{}
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, name := range []string{"date", "close"} {
+		if _, ok := cols[name]; !ok {
+			return nil, fmt.Errorf("the csv has no %s column", name)
+		}
+	}
+	if _, ok := cols["ticker"]; !ok && defaultTicker == "" {
+		return nil, errors.New("the csv has no ticker column, add it or the ticker param")
+	}
+
+	var out []PriceRecord
+	var problems []string
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			problems = append(problems, err.Error())
+			break
+		}
+		field := func(name string) string {
+			if i, ok := cols[name]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+		// los campos requeridos tienen que ser mayores a 0, los opcionales no negativos
+		number := func(name string, required bool) float64 {
+			s := field(name)
+			if s == "" {
+				if required {
+					problems = append(problems, fmt.Sprintf("line %d: %s is required", line, name))
+				}
+				return 0
+			}
+			v, err := strconv.ParseFloat(s, 64)
+			if err != nil || v < 0 || (required && v == 0) || math.IsNaN(v) || math.IsInf(v, 0) {
+				problems = append(problems, fmt.Sprintf("line %d: invalid %s %q", line, name, s))
+				return 0
+			}
+			return v
+		}
+		rec := PriceRecord{Ticker: strings.ToUpper(field("ticker"))}
+		if rec.Ticker == "" {
+			rec.Ticker = defaultTicker
+		}
+		d, err := time.Parse(DateFormat, field("date"))
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("line %d: invalid date %q", line, field("date")))
+		}
+		rec.Date = Fecha(d)
+		rec.Close = number("close", true)
+		rec.Bid, rec.Ask, rec.Volume = number("bid", false), number("ask", false), number("volume", false)
+		out = append(out, rec)
+	}
+	if len(problems) > 0 {
+		return nil, errors.New(strings.Join(problems, "; "))
+	}
+	return out, nil
+}
+
+// priceRangeFromQuery reads the optional from and to params. Without them the range is open.
+func priceRangeFromQuery(c *gin.Context) (time.Time, time.Time, error) {
+	from, to := time.Time{}, time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+	var err error
+	if s := c.Query("from"); s != "" {
+		if from, err = time.Parse(DateFormat, s); err != nil {
+			return from, to, errors.New("invalid from date")
+		}
+	}
+	if s := c.Query("to"); s != "" {
+		if to, err = time.Parse(DateFormat, s); err != nil {
+			return from, to, errors.New("invalid to date")
+		}
+	}
+	if to.Before(from) {
+		return from, to, errors.New("to should not be before from")
+	}
+	return from, to, nil
+}
+
+// importPricesWrapper stores the prices of a csv, sent as the body or as the file field of a multipart form.
+// The tickers must be in bonds.json. The ticker param is used for csvs without a ticker column.
+func importPricesWrapper(c *gin.Context) {
+	var body io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file is required: " + err.Error()})
+			return
+		}
+		f, err := fh.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer f.Close()
+		body = f
+	}
+	records, err := parsePricesCSV(body, strings.ToUpper(c.Query("ticker")))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	bonds := currentBonds()
+	unknown := map[string]bool{}
+	var missing []string
+	for _, r := range records {
+		if _, _, err := getCashFlow(bonds, r.Ticker); err != nil && !unknown[r.Ticker] {
+			unknown[r.Ticker] = true
+			missing = append(missing, r.Ticker)
+		}
+	}
+	if len(missing) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown tickers: " + strings.Join(missing, ", ")})
+		return
+	}
+	inserted, updated, err := prices.Upsert(c.Request.Context(), records)
+	if err != nil {
+		fmt.Println("Error when saving prices:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"Result": "Prices imported", "Rows": len(records), "Inserted": inserted, "Updated": updated})
+}
+
+func listPricesWrapper(c *gin.Context) {
+	tickers, err := prices.Tickers(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tickers)
+}
+
+// getPricesWrapper returns the stored prices of a ticker between from and to.
+func getPricesWrapper(c *gin.Context) {
+	ticker := strings.ToUpper(c.Param("ticker"))
+	from, to, err := priceRangeFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	list, err := prices.Series(c.Request.Context(), ticker, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"Ticker": ticker, "Prices": list})
+}
+
+// deletePricesWrapper removes the prices of a ticker between from and to, all of them without both.
+func deletePricesWrapper(c *gin.Context) {
+	ticker := strings.ToUpper(c.Param("ticker"))
+	from, to, err := priceRangeFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	deleted, err := prices.Delete(c.Request.Context(), ticker, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	} else if deleted == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no prices found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"Result": "Prices deleted", "Ticker": ticker, "Deleted": deleted})
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePricesCSV(t *testing.T) {
+	tests := []struct {
+		name          string
+		csv           string
+		defaultTicker string
+		want          []PriceRecord
+		wantErr       string // part of the error, "" if none
+	}{
+		{
+			name: "all columns",
+			csv:  "ticker,date,close,bid,ask,volume\ngd30,2024-06-10,60.5,60.25,60.75,1000\nAL30,2024-06-10,58,,,\n",
+			want: []PriceRecord{
+				{Ticker: "GD30", Date: Fecha(mustDate("2024-06-10")), Close: 60.5, Bid: 60.25, Ask: 60.75, Volume: 1000},
+				{Ticker: "AL30", Date: Fecha(mustDate("2024-06-10")), Close: 58},
+			},
+		},
+		{
+			name: "columns in any order with a BOM and spaces",
+			csv:  "\ufeffClose, Date ,Ticker\n 61 , 2024-06-11 , GD30\n",
+			want: []PriceRecord{{Ticker: "GD30", Date: Fecha(mustDate("2024-06-11")), Close: 61}},
+		},
+		{
+			name:          "default ticker",
+			csv:           "date,close\n2024-06-10,60\n2024-06-11,61\n",
+			defaultTicker: "GD30",
+			want: []PriceRecord{
+				{Ticker: "GD30", Date: Fecha(mustDate("2024-06-10")), Close: 60},
+				{Ticker: "GD30", Date: Fecha(mustDate("2024-06-11")), Close: 61},
+			},
+		},
+		{
+			name:          "the ticker column wins over the default",
+			csv:           "ticker,date,close\nAL30,2024-06-10,58\n,2024-06-11,59\n",
+			defaultTicker: "GD30",
+			want: []PriceRecord{
+				{Ticker: "AL30", Date: Fecha(mustDate("2024-06-10")), Close: 58},
+				{Ticker: "GD30", Date: Fecha(mustDate("2024-06-11")), Close: 59},
+			},
+		},
+		{name: "empty", csv: "", wantErr: "empty csv"},
+		{name: "no close column", csv: "ticker,date\nGD30,2024-06-10\n", wantErr: "no close column"},
+		{name: "no ticker column nor default", csv: "date,close\n2024-06-10,60\n", wantErr: "no ticker column"},
+		{name: "bad date", csv: "ticker,date,close\nGD30,10/06/2024,60\n", wantErr: `line 2: invalid date "10/06/2024"`},
+		{name: "zero close", csv: "ticker,date,close\nGD30,2024-06-10,0\n", wantErr: `line 2: invalid close "0"`},
+		{name: "missing close", csv: "ticker,date,close\nGD30,2024-06-10,\n", wantErr: "line 2: close is required"},
+		{name: "negative bid", csv: "ticker,date,close,bid\nGD30,2024-06-10,60,-1\n", wantErr: `line 2: invalid bid "-1"`},
+		{name: "NaN close", csv: "ticker,date,close\nGD30,2024-06-10,NaN\n", wantErr: `line 2: invalid close "NaN"`},
+		{
+			name:    "every bad row is reported",
+			csv:     "ticker,date,close\nGD30,2024-06-10,60\nGD30,x,60\nGD30,2024-06-12,abc\n",
+			wantErr: `line 3: invalid date "x"; line 4: invalid close "abc"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePricesCSV(strings.NewReader(tt.csv), tt.defaultTicker)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				if got != nil {
+					t.Errorf("got %d records with an error, want none", len(got))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got  %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestPriceStore runs against the database of the POSTGRES_* variables and removes the prices it adds.
+func TestPriceStore(t *testing.T) {
+	if os.Getenv("POSTGRES_HOST") == "" {
+		t.Skip("POSTGRES_HOST is not set")
+	}
+	ctx := context.Background()
+	s := &priceStore{pool: pgPool{ddl: []string{bondPricesDDL}}}
+	ticker := fmt.Sprintf("TEST%d", time.Now().UnixNano())
+	rec := func(d string, price float64) PriceRecord {
+		return PriceRecord{Ticker: ticker, Date: Fecha(mustDate(d)), Close: price}
+	}
+	all := time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+	defer s.Delete(ctx, ticker, time.Time{}, all)
+
+	tests := []struct {
+		name         string
+		records      []PriceRecord
+		wantInserted int
+		wantUpdated  int
+		wantCloses   []float64 // all the prices of the ticker after the upsert, by date
+	}{
+		{"new prices", []PriceRecord{rec("2024-06-11", 61), rec("2024-06-10", 60)}, 2, 0, []float64{60, 61}},
+		{"a date already stored is replaced", []PriceRecord{rec("2024-06-11", 62), rec("2024-06-12", 63)}, 1, 1, []float64{60, 62, 63}},
+	}
+	for _, tt := range tests {
+		inserted, updated, err := s.Upsert(ctx, tt.records)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if inserted != tt.wantInserted || updated != tt.wantUpdated {
+			t.Errorf("%s: inserted %d updated %d, want %d %d", tt.name, inserted, updated, tt.wantInserted, tt.wantUpdated)
+		}
+		series, err := s.Series(ctx, ticker, time.Time{}, all)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var closes []float64
+		for _, r := range series {
+			closes = append(closes, r.Close)
+		}
+		if !reflect.DeepEqual(closes, tt.wantCloses) {
+			t.Errorf("%s: got %v, want %v", tt.name, closes, tt.wantCloses)
+		}
+	}
+
+	series, err := s.Series(ctx, ticker, mustDate("2024-06-11"), mustDate("2024-06-11"))
+	if err != nil || len(series) != 1 || !time.Time(series[0].Date).Equal(mustDate("2024-06-11")) {
+		t.Errorf("Series of one day: got %+v, %v", series, err)
+	}
+	tickers, err := s.Tickers(ctx)
+	if err != nil || tickers[ticker] != 3 {
+		t.Errorf("Tickers: got %d prices of %s, %v, want 3", tickers[ticker], ticker, err)
+	}
+	if n, err := s.Delete(ctx, ticker, mustDate("2024-06-11"), all); err != nil || n != 2 {
+		t.Errorf("Delete: got %d, %v, want 2", n, err)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Ways a price can be quoted.
+const (
+	PriceDirty = "dirty" // full amount paid, accrued interest included (default, as Yield and Price work)
+	PriceClean = "clean" // without the accrued interest
+)
+
+// normalizePriceType maps a price type to PriceDirty or PriceClean. Empty is returned as empty so callers can fall back.
+func normalizePriceType(priceType string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(priceType)) {
+	case "":
+		return "", nil
+	case PriceDirty, "full":
+		return PriceDirty, nil
+	case PriceClean:
+		return PriceClean, nil
+	}
+	return "", fmt.Errorf("unknown price type %q, use clean or dirty", priceType)
+}
+
+// priceTypeFor returns the price type of a request: the priceType param, or the bond's PriceType, or dirty.
+func priceTypeFor(b Bond, param string) (string, error) {
+	pt, err := normalizePriceType(param)
+	if err != nil || pt != "" {
+		return pt, err
+	}
+	if pt, err = normalizePriceType(b.PriceType); err != nil || pt != "" {
+		return pt, err
+	}
+	return PriceDirty, nil
+}
+
+// toDirty converts a price of priceType to a dirty price, accInt being the accrued interest on the same basis (see extendedInfo).
+func toDirty(price float64, priceType string, accInt float64) float64 {
+	if priceType == PriceClean {
+		return price + accInt
+	}
+	return price
+}
+
+// fromDirty converts a dirty price to priceType.
+func fromDirty(price float64, priceType string, accInt float64) float64 {
+	if priceType == PriceClean {
+		return price - accInt
+	}
+	return price
+}
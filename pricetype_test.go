@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestPriceTypeFor(t *testing.T) {
+	tests := []struct {
+		name      string
+		bondType  string
+		param     string
+		want      string
+		wantError bool
+	}{
+		{"default is dirty", "", "", PriceDirty, false},
+		{"bond type", "clean", "", PriceClean, false},
+		{"param overrides the bond", "clean", "Dirty", PriceDirty, false},
+		{"full is dirty", "", "full", PriceDirty, false},
+		{"unknown param", "", "mid", "", true},
+		{"unknown bond type", "mid", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := priceTypeFor(Bond{PriceType: tt.bondType}, tt.param)
+			if (err != nil) != tt.wantError || got != tt.want {
+				t.Errorf("got %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCleanDirtyConversions(t *testing.T) {
+	tests := []struct {
+		name      string
+		priceType string
+		price     float64
+		accInt    float64
+		dirty     float64
+	}{
+		{"clean adds the accrued interest", PriceClean, 98.5, 1.25, 99.75},
+		{"dirty is kept", PriceDirty, 98.5, 1.25, 98.5},
+		{"clean in the ex-coupon period", PriceClean, 98.5, -0.5, 98},
+		{"clean without accrued interest", PriceClean, 98.5, 0, 98.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := toDirty(tt.price, tt.priceType, tt.accInt); got != tt.dirty {
+				t.Errorf("toDirty = %v, want %v", got, tt.dirty)
+			}
+			if got := fromDirty(tt.dirty, tt.priceType, tt.accInt); got != tt.price {
+				t.Errorf("fromDirty = %v, want %v", got, tt.price)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"time"
+
+	"github.com/rickar/cal/v2"
+)
+
+// recordDate is the date a holder must have settled by to be paid on payment: days business days of c
+// before it (Bond.RecordDays). With 0 days it is the payment date itself.
+func recordDate(payment time.Time, days int, c *cal.BusinessCalendar) time.Time {
+	if days <= 0 || c == nil {
+		return payment
+	}
+	return c.WorkdaysFrom(payment, -days)
+}
+
+// entitledCashflow returns the payments a buyer settling on settlementDate receives: the ones whose
+// record date is not before settlementDate. Payments in their ex-coupon period go to the seller.
+func entitledCashflow(flow []Flujo, settlementDate time.Time, days int, c *cal.BusinessCalendar) []Flujo {
+	out := []Flujo{}
+	for _, cf := range flow {
+		if !recordDate(time.Time(cf.Date), days, c).Before(settlementDate) {
+			out = append(out, cf)
+		}
+	}
+	return out
+}
+
+// entitlement returns the face value state of the bond for a buyer settling on settlementDate and the payments
+// that buyer receives. Record dates are counted on the bond's calendar.
+func (md *marketData) entitlement(b Bond, flow []Flujo, settlementDate time.Time) (faceState, []Flujo, error) {
+	c, err := md.calendar(b.Calendar)
+	if err != nil {
+		return faceState{}, nil, err
+	}
+	face := faceStateAt(flow, time.Time(b.IssueDate), settlementDate, b.RecordDays, c)
+	return face, entitledCashflow(flow, settlementDate, b.RecordDays, c), nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFaceStateAtExCoupon(t *testing.T) {
+	issue := mustDate("2024-01-01")
+	weekdays := newCalendarWithHolidays(nil)
+	// el primer pago es el lunes 2024-07-01: con 3 días hábiles el record date es el miércoles 2024-06-26
+	tests := []struct {
+		name        string
+		date        string
+		recordDays  int
+		ex          bool
+		lastPayment string
+		residual    float64
+		accrualBase float64
+		accDays     int
+		entitled    int // payments due to the buyer
+	}{
+		{"without record days", "2024-06-28", 0, false, "2024-01-01", 100, 100, 179, 2},
+		{"on the record date", "2024-06-26", 3, false, "2024-01-01", 100, 100, 177, 2},
+		{"ex-coupon", "2024-06-28", 3, true, "2024-07-01", 50, 100, -3, 1},
+		{"ex-coupon on the payment date", "2024-07-01", 3, true, "2024-07-01", 50, 100, 0, 1},
+		{"after the payment", "2024-07-02", 3, false, "2024-07-01", 50, 50, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			date := mustDate(tt.date)
+			s := faceStateAt(amortizingFlow, issue, date, tt.recordDays, weekdays)
+			if s.ex != tt.ex || s.lastPayment.Format(DateFormat) != tt.lastPayment {
+				t.Errorf("ex %v lastPayment %s, want %v %s", s.ex, s.lastPayment.Format(DateFormat), tt.ex, tt.lastPayment)
+			}
+			if s.residual != tt.residual || s.accrualBase != tt.accrualBase || s.accDays != tt.accDays {
+				t.Errorf("residual %v accrualBase %v accDays %d, want %v %v %d", s.residual, s.accrualBase, s.accDays, tt.residual, tt.accrualBase, tt.accDays)
+			}
+			if want := float64(tt.accDays) / 360 * 0.05 * tt.accrualBase; s.accrued() != want {
+				t.Errorf("accrued %v, want %v", s.accrued(), want)
+			}
+			if got := entitledCashflow(amortizingFlow, date, tt.recordDays, weekdays); len(got) != tt.entitled {
+				t.Errorf("%d payments entitled, want %d", len(got), tt.entitled)
+			}
+		})
+	}
+}
+
+func TestRecordDate(t *testing.T) {
+	weekdays := newCalendarWithHolidays([]time.Time{mustDate("2024-06-28")})
+	tests := []struct {
+		payment string
+		days    int
+		want    string
+	}{
+		{"2024-07-01", 0, "2024-07-01"},
+		{"2024-07-01", 1, "2024-06-27"}, // el viernes es feriado
+		{"2024-07-01", 3, "2024-06-25"},
+	}
+	for _, tt := range tests {
+		if got := recordDate(mustDate(tt.payment), tt.days, weekdays).Format(DateFormat); got != tt.want {
+			t.Errorf("recordDate(%s, %d) = %s, want %s", tt.payment, tt.days, got, tt.want)
+		}
+	}
+	if got := recordDate(mustDate("2024-07-01"), 3, nil); !got.Equal(mustDate("2024-07-01")) {
+		t.Errorf("without calendar got %s, want the payment date", got.Format(DateFormat))
+	}
+}
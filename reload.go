@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bondsMu guards Bonds. Bonds is never modified in place: a reload or an upload swaps in a new slice,
+// so a handler that took the slice with currentBonds keeps a consistent set for the whole request.
+var bondsMu sync.RWMutex
+
+// Intervalo con el que se revisa si bonds.json cambió, si BONDS_WATCH_INTERVAL no está definida.
+const defaultBondsWatchInterval = 5 * time.Second
+
+func currentBonds() []Bond {
+	bondsMu.RLock()
+	defer bondsMu.RUnlock()
+	return Bonds
+}
+
+func setBonds(bonds []Bond) {
+	bondsMu.Lock()
+	Bonds = bonds
+	bondsMu.Unlock()
+}
+
+// bondsDiff lists the tickers that changed between two sets of bonds.
+type bondsDiff struct {
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+func diffBonds(old []Bond, new []Bond) bondsDiff {
+	oldByTicker := make(map[string]Bond)
+	for _, b := range old {
+		if _, ok := oldByTicker[b.Ticker]; !ok {
+			oldByTicker[b.Ticker] = b
+		}
+	}
+	newByTicker := make(map[string]Bond)
+	for _, b := range new {
+		if _, ok := newByTicker[b.Ticker]; !ok {
+			newByTicker[b.Ticker] = b
+		}
+	}
+
+	diff := bondsDiff{Added: []string{}, Removed: []string{}, Changed: []string{}}
+	for ticker, b := range newByTicker {
+		prev, ok := oldByTicker[ticker]
+		if !ok {
+			diff.Added = append(diff.Added, ticker)
+		} else if !reflect.DeepEqual(prev, b) {
+			diff.Changed = append(diff.Changed, ticker)
+		}
+	}
+	for ticker := range oldByTicker {
+		if _, ok := newByTicker[ticker]; !ok {
+			diff.Removed = append(diff.Removed, ticker)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	return diff
+}
+
+// setBondDefaults fills the fields that bonds saved before they existed lack, so older files, uploads and versions
+// keep loading: a bond without Currency pays ARS if it is adjusted by an index and USD otherwise, and a bond
+// without Issuer is sovereign, as every bond the service was loaded with.
+func setBondDefaults(b *Bond) {
+	b.Currency = strings.ToUpper(strings.TrimSpace(b.Currency))
+	if b.Currency == "" {
+		b.Currency = "USD"
+		if b.Index != "" {
+			b.Currency = "ARS"
+		}
+	}
+	if strings.TrimSpace(b.Issuer) == "" {
+		b.Issuer = IssuerSovereign
+	}
+}
+
+// validateBonds checks that every bond can be valued. It returns all the problems found, not only the first one.
+func validateBonds(bonds []Bond) error {
+	if len(bonds) == 0 {
+		return errors.New("no bonds found")
+	}
+	var problems []string
+	for i, b := range bonds {
+		name := b.Ticker
+		if name == "" {
+			name = fmt.Sprintf("bond #%d", i+1)
+			problems = append(problems, name+": empty ticker")
+		}
+		if len(b.Cashflow) == 0 {
+			problems = append(problems, name+": empty cashflow")
+		}
+		if time.Time(b.Maturity).IsZero() {
+			problems = append(problems, name+": missing maturity")
+		}
+		if !validCurrency(b.Currency) {
+			problems = append(problems, fmt.Sprintf("%s: invalid currency %q, use a code as USD or ARS", name, b.Currency))
+		}
+		if b.Index != "" && !knownIndex(b.Index) {
+			problems = append(problems, name+": unknown index "+b.Index)
+		}
+		if _, err := normalizeCalendar(b.Calendar); err != nil {
+			problems = append(problems, name+": "+err.Error())
+		}
+		if _, err := normalizeRoll(b.Roll); err != nil {
+			problems = append(problems, name+": "+err.Error())
+		}
+		if _, err := normalizePriceType(b.PriceType); err != nil {
+			problems = append(problems, name+": "+err.Error())
+		}
+		if _, err := normalizeIssuer(b.Issuer); err != nil {
+			problems = append(problems, name+": "+err.Error())
+		}
+		for _, p := range validateRedemptions(b) {
+			problems = append(problems, name+": "+p)
+		}
+		if b.isDual() {
+			for _, p := range validateLegs(b) {
+				problems = append(problems, name+": "+p)
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// reloadBonds re-reads the bonds from the store and swaps them in only if they are valid.
+func reloadBonds(ctx context.Context) (bondsDiff, error) {
+	bonds, err := bondStore.Load(ctx)
+	if err != nil {
+		markDependency(depBonds, 0, err)
+		return bondsDiff{}, err
+	}
+	if err := validateBonds(bonds); err != nil {
+		err = fmt.Errorf("invalid bonds, keeping the loaded ones: %w", err)
+		markDependency(depBonds, 0, err)
+		return bondsDiff{}, err
+	}
+	diff := diffBonds(currentBonds(), bonds)
+	setBonds(bonds)
+	markDependency(depBonds, len(bonds), nil)
+	startIndexLoads(time.Minute) // un bono nuevo puede usar un índice que no se cargaba
+	return diff, nil
+}
+
+func reloadWrapper(c *gin.Context) {
+	diff, err := reloadBonds(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"Result":  "Bonds reloaded",
+		"Bonds":   len(currentBonds()),
+		"Added":   diff.Added,
+		"Removed": diff.Removed,
+		"Changed": diff.Changed,
+	})
+}
+
+// watchBondsFile polls the modification time of path and reloads the bonds when it changes.
+// Polling keeps us free of platform specific notification APIs and is plenty for a file edited by hand.
+func watchBondsFile(path string, interval time.Duration) {
+	lastMod := modTime(path)
+	t := time.NewTicker(interval)
+	for range t.C {
+		mod := modTime(path)
+		if mod.Equal(lastMod) {
+			continue
+		}
+		lastMod = mod
+		diff, err := reloadBonds(context.Background())
+		if err != nil {
+			fmt.Println("Recarga de bonos falló:", err)
+			continue
+		}
+		fmt.Println("Bonos recargados. Nuevos:", diff.Added, "Eliminados:", diff.Removed, "Modificados:", diff.Changed)
+	}
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// Devuelve el intervalo de BONDS_WATCH_INTERVAL (ej. "10s") o el default.
+func bondsWatchInterval() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("BONDS_WATCH_INTERVAL")); err == nil && d > 0 {
+		return d
+	}
+	return defaultBondsWatchInterval
+}
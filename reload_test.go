@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDiffBonds(t *testing.T) {
+	a := Bond{Ticker: "AAA", Coupon: 0.01}
+	b := Bond{Ticker: "BBB", Coupon: 0.02}
+	c := Bond{Ticker: "CCC", Coupon: 0.03}
+	tests := []struct {
+		name string
+		old  []Bond
+		new  []Bond
+		want bondsDiff
+	}{
+		{"same", []Bond{a, b}, []Bond{b, a}, bondsDiff{Added: []string{}, Removed: []string{}, Changed: []string{}}},
+		{"from nothing", nil, []Bond{b, a}, bondsDiff{Added: []string{"AAA", "BBB"}, Removed: []string{}, Changed: []string{}}},
+		{"added, removed and changed", []Bond{a, b}, []Bond{{Ticker: "AAA", Coupon: 0.05}, c}, bondsDiff{Added: []string{"CCC"}, Removed: []string{"BBB"}, Changed: []string{"AAA"}}},
+		// como getCashFlow, de un ticker repetido cuenta el primero
+		{"first of a repeated ticker", []Bond{a}, []Bond{a, {Ticker: "AAA", Coupon: 0.05}}, bondsDiff{Added: []string{}, Removed: []string{}, Changed: []string{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diffBonds(tt.old, tt.new); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetBondDefaults(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       Bond
+		currency string
+		issuer   string
+	}{
+		{"hard dollar", Bond{Ticker: "GD30"}, "USD", IssuerSovereign},
+		{"CER adjusted", Bond{Ticker: "TX26", Index: "CER"}, "ARS", IssuerSovereign},
+		{"UVA adjusted", Bond{Ticker: "UVA1", Index: "UVA"}, "ARS", IssuerSovereign},
+		{"own currency and issuer are kept", Bond{Ticker: "TV24", Currency: " ars ", Issuer: "corporate"}, "ARS", IssuerCorporate},
+	}
+	for _, tt := range tests {
+		b := tt.in
+		setBondDefaults(&b)
+		if b.Currency != tt.currency || b.Issuer != tt.issuer {
+			t.Errorf("%s: currency %q issuer %q, want %q %q", tt.name, b.Currency, b.Issuer, tt.currency, tt.issuer)
+		}
+	}
+}
+
+// useBondStore makes the handlers read the bonds from a bonds.json with bonds and puts back the store when the test ends.
+func useBondStore(t *testing.T, bonds []Bond) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "bonds.json")
+	if err := writeBondsFixture(path, bonds); err != nil {
+		t.Fatal(err)
+	}
+	prev := bondStore
+	bondStore = &fileBondStore{path: path, keepBackups: 1}
+	t.Cleanup(func() { bondStore = prev })
+	return path
+}
+
+func TestReloadWrapper(t *testing.T) {
+	loaded := tenPercentBond("AAA")
+	changed := tenPercentBond("AAA")
+	changed.Coupon = 0.2
+	badCurrency := tenPercentBond("BBB")
+	badCurrency.Currency = "pesos"
+	older := tenPercentBond("CCC")
+	older.Currency, older.Issuer = "", ""
+	olderDefaulted := tenPercentBond("CCC")
+	olderDefaulted.Currency, olderDefaulted.Issuer = "USD", IssuerSovereign
+	tests := []struct {
+		name      string
+		file      []Bond
+		code      int
+		wantDiff  bondsDiff
+		wantBonds []Bond // served after the reload
+	}{
+		{"added and changed", []Bond{changed, tenPercentBond("CCC")}, http.StatusOK, bondsDiff{Added: []string{"CCC"}, Removed: []string{}, Changed: []string{"AAA"}}, []Bond{changed, tenPercentBond("CCC")}},
+		{"a bond saved without currency nor issuer gets the defaults", []Bond{loaded, older}, http.StatusOK, bondsDiff{Added: []string{"CCC"}, Removed: []string{}, Changed: []string{}}, []Bond{loaded, olderDefaulted}},
+		{"invalid set keeps the loaded bonds", []Bond{changed, badCurrency}, http.StatusUnprocessableEntity, bondsDiff{}, []Bond{loaded}},
+		{"empty set keeps the loaded bonds", []Bond{}, http.StatusUnprocessableEntity, bondsDiff{}, []Bond{loaded}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestMarket(t, []Bond{loaded}, dailyCER("2024-01-01", "2024-01-31"), nil)
+			useBondStore(t, tt.file)
+
+			gin.SetMode(gin.TestMode)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/admin/reload", nil)
+			reloadWrapper(c)
+			if w.Code != tt.code {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.code, w.Body.String())
+			}
+			if tt.code == http.StatusOK {
+				var out bondsDiff
+				if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(out, tt.wantDiff) {
+					t.Errorf("diff %+v, want %+v", out, tt.wantDiff)
+				}
+			}
+			if got := currentBonds(); !reflect.DeepEqual(got, tt.wantBonds) {
+				t.Errorf("serving %d bonds, want %d", len(got), len(tt.wantBonds))
+			}
+			if !dependencyReady(depBonds) {
+				t.Error("bonds are not ready after a reload")
+			}
+		})
+	}
+}
+
+// At startup an invalid set is refused as by a reload: nothing is served and the bonds are not ready.
+func TestGetBondsData(t *testing.T) {
+	valid := tenPercentBond("AAA")
+	invalid := tenPercentBond("BBB")
+	invalid.Cashflow = nil
+	tests := []struct {
+		name      string
+		file      []Bond
+		ready     bool
+		wantBonds int
+	}{
+		{"valid", []Bond{valid}, true, 1},
+		{"invalid", []Bond{valid, invalid}, false, 0},
+		{"empty", []Bond{}, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestMarket(t, nil, dailyCER("2024-01-01", "2024-01-31"), nil)
+			depsMu.Lock()
+			deps[depBonds] = &depStatus{Name: depBonds, Required: true}
+			depsMu.Unlock()
+			useBondStore(t, tt.file)
+
+			getBondsData()
+			if got := len(currentBonds()); got != tt.wantBonds {
+				t.Errorf("serving %d bonds, want %d", got, tt.wantBonds)
+			}
+			if dependencyReady(depBonds) != tt.ready {
+				t.Errorf("bonds ready %v, want %v", !tt.ready, tt.ready)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ScenariosFile is the path of the json holding the scenarios, unless SCENARIOS_PATH is set.
+const ScenariosFile = "./scenarios.json"
+
+// Types of issuer, see Bond.Issuer.
+const (
+	IssuerSovereign  = "sovereign"
+	IssuerProvincial = "provincial"
+	IssuerCorporate  = "corporate"
+)
+
+// normalizeIssuer maps an issuer type to one of the Issuer constants. Every bond has one (see setBondDefaults), so a spread shock
+// never misses a corporate or provincial bond.
+func normalizeIssuer(issuer string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(issuer)) {
+	case "":
+		return "", errors.New("missing issuer, use sovereign, provincial or corporate")
+	case IssuerSovereign:
+		return IssuerSovereign, nil
+	case IssuerProvincial, "province", "sub-sovereign":
+		return IssuerProvincial, nil
+	case IssuerCorporate, "corp", "on":
+		return IssuerCorporate, nil
+	}
+	return "", fmt.Errorf("unknown issuer %q, use sovereign, provincial or corporate", issuer)
+}
+
+// Plazo en años donde termina el twist de una curva.
+const twistYears = 10.0
+
+// CurveShock moves the yields of one curve: ShiftBp in parallel plus a twist from ShortBp at 0 years to
+// LongBp at 10 years or more to maturity, linear in between.
+type CurveShock struct {
+	ShiftBp float64 `json:",omitempty"`
+	ShortBp float64 `json:",omitempty"`
+	LongBp  float64 `json:",omitempty"`
+}
+
+// Scenario is a named set of shocks applied at once, or at HorizonDays calendar days after the settlement date:
+//   - ShiftBp moves every yield in parallel and Curves each curve, keyed by index (CER, UVA) or, for bonds without one, currency.
+//   - IndexShock moves the level of an index (0.05 is 5% more CER) and IndexGrowth is the annual growth used to extend
+//     it past its last value, as extendIndex.
+//   - FXShock devalues the base currency against another one (0.3 is 30% more base currency per unit).
+//   - SpreadBp widens the yields by type of issuer, e.g. {"corporate": 150}.
+type Scenario struct {
+	Name        string
+	Description string                `json:",omitempty"`
+	HorizonDays int                   `json:",omitempty"`
+	ShiftBp     float64               `json:",omitempty"`
+	Curves      map[string]CurveShock `json:",omitempty"`
+	IndexShock  map[string]float64    `json:",omitempty"`
+	IndexGrowth map[string]float64    `json:",omitempty"`
+	FXShock     map[string]float64    `json:",omitempty"`
+	SpreadBp    map[string]float64    `json:",omitempty"`
+}
+
+// normalizeScenario uppercases the curves, indices and currencies and lowercases the issuer types.
+func normalizeScenario(s *Scenario) {
+	upper := func(m map[string]float64) map[string]float64 {
+		if m == nil {
+			return nil
+		}
+		out := map[string]float64{}
+		for k, v := range m {
+			out[strings.ToUpper(strings.TrimSpace(k))] = v
+		}
+		return out
+	}
+	s.IndexShock = upper(s.IndexShock)
+	s.IndexGrowth = upper(s.IndexGrowth)
+	s.FXShock = upper(s.FXShock)
+	if s.Curves != nil {
+		curves := map[string]CurveShock{}
+		for k, v := range s.Curves {
+			curves[strings.ToUpper(strings.TrimSpace(k))] = v
+		}
+		s.Curves = curves
+	}
+	if s.SpreadBp != nil {
+		spreads := map[string]float64{}
+		for k, v := range s.SpreadBp {
+			if issuer, err := normalizeIssuer(k); err == nil {
+				k = issuer
+			}
+			spreads[k] = v
+		}
+		s.SpreadBp = spreads
+	}
+}
+
+// validateScenario checks the shocks of a scenario.
+func validateScenario(s Scenario) error {
+	var problems []string
+	if strings.TrimSpace(s.Name) == "" {
+		problems = append(problems, "empty name")
+	}
+	if s.HorizonDays < 0 {
+		problems = append(problems, "HorizonDays should not be negative")
+	}
+	for name, v := range s.IndexShock {
+		if !knownIndex(name) {
+			problems = append(problems, "IndexShock: unknown index "+name)
+		}
+		if v <= -1 {
+			problems = append(problems, "IndexShock of "+name+" should be greater than -1")
+		}
+	}
+	for name, v := range s.IndexGrowth {
+		if !knownIndex(name) {
+			problems = append(problems, "IndexGrowth: unknown index "+name)
+		}
+		if v < 0 {
+			problems = append(problems, "IndexGrowth of "+name+" should not be negative")
+		}
+	}
+	for cur, v := range s.FXShock {
+		if v <= -1 {
+			problems = append(problems, "FXShock of "+cur+" should be greater than -1")
+		}
+	}
+	for issuer := range s.SpreadBp {
+		if _, err := normalizeIssuer(issuer); err != nil {
+			problems = append(problems, "SpreadBp: "+err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// scenarioStore keeps the scenarios in a single json file, written atomically on every change, as portfolioStore.
+type scenarioStore struct {
+	*namedStore
+}
+
+var scenarios = &scenarioStore{newNamedStore("SCENARIOS_PATH", ScenariosFile)}
+
+func (s *scenarioStore) List() ([]Scenario, error) {
+	list := []Scenario{}
+	if err := s.list(&list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Get returns the scenario called name, or false if there is none.
+func (s *scenarioStore) Get(name string) (Scenario, bool, error) {
+	var sc Scenario
+	ok, err := s.get(name, &sc)
+	return sc, ok, err
+}
+
+// Save adds the scenario or replaces the one with the same name.
+func (s *scenarioStore) Save(sc Scenario) error {
+	return s.save(sc.Name, sc)
+}
+
+func listScenariosWrapper(c *gin.Context) {
+	list, err := scenarios.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func getScenarioWrapper(c *gin.Context) {
+	sc, ok, err := scenarios.Get(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	} else if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "scenario not found"})
+		return
+	}
+	c.JSON(http.StatusOK, sc)
+}
+
+// saveScenarioWrapper stores the scenario of the body under the name of the path.
+func saveScenarioWrapper(c *gin.Context) {
+	var sc Scenario
+	if err := c.ShouldBindJSON(&sc); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sc.Name = c.Param("name")
+	normalizeScenario(&sc)
+	if err := validateScenario(sc); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := scenarios.Save(sc); err != nil {
+		fmt.Println("Error when saving scenario:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, sc)
+}
+
+func deleteScenarioWrapper(c *gin.Context) {
+	ok, err := scenarios.Delete(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	} else if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "scenario not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"Result": "Scenario deleted", "Name": c.Param("name")})
+}
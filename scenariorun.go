@@ -0,0 +1,313 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// scenarioCurve is the curve of a bond in Scenario.Curves: its index or, if it has none, its currency.
+func scenarioCurve(b Bond) string {
+	if b.Index != "" {
+		return strings.ToUpper(b.Index)
+	}
+	return strings.ToUpper(b.Currency)
+}
+
+// yieldShift is the change of the yield of b under the scenario, in rate units (100bp = 0.01), for years to maturity.
+func (sc Scenario) yieldShift(b Bond, years float64) float64 {
+	bp := sc.ShiftBp
+	if cs, ok := sc.Curves[scenarioCurve(b)]; ok {
+		bp += cs.ShiftBp + cs.ShortBp + (cs.LongBp-cs.ShortBp)*math.Min(math.Max(years, 0)/twistYears, 1)
+	}
+	if issuer, err := normalizeIssuer(b.Issuer); err == nil {
+		bp += sc.SpreadBp[issuer]
+	}
+	return bp / 10000
+}
+
+// scenarioPosition is a position revalued under a scenario. Prices are dirty per 100 of original face value and index
+// adjusted. Coupons are the payments received between the settlement date and the horizon. Values are in the base currency.
+type scenarioPosition struct {
+	Ticker        string
+	Curve         string
+	ShiftBp       float64
+	BaseYield     float64
+	Yield         float64
+	BasePrice     float64
+	Price         float64
+	BaseMDuration float64
+	MDuration     float64
+	Coupons       float64
+	IndexRatio    float64
+	BaseValue     float64
+	Value         float64
+	PnL           float64
+}
+
+// scenarioResult is a portfolio revalued under a scenario. Yield and MDuration are weighted by value, as the valuation.
+type scenarioResult struct {
+	Scenario    string
+	Description string `json:",omitempty"`
+	Horizon     Fecha
+	MarketValue float64
+	PnL         float64
+	PnLPct      float64
+	Yield       float64
+	MDuration   float64
+	Positions   []scenarioPosition
+}
+
+// revalue prices a position under sc at the horizon: the base yield moved by the scenario, the index ratio at the horizon
+// with the scenario's growth and shock, and the payments received up to the horizon added as coupons.
+// Values are per the bond's currency; the caller converts them.
+func (md *marketData) revalue(b Bond, pos Position, base positionValue, sc Scenario, settlementDate time.Time, extendIndex float64) (scenarioPosition, error) {
+	horizon := settlementDate.AddDate(0, 0, sc.HorizonDays)
+	years := time.Time(b.Maturity).Sub(horizon).Hours() / 24 / 365
+	shift := sc.yieldShift(b, years)
+	sp := scenarioPosition{
+		Ticker:        b.Ticker,
+		Curve:         scenarioCurve(b),
+		ShiftBp:       shift * 10000,
+		BaseYield:     base.Yield,
+		Yield:         base.Yield + shift,
+		BasePrice:     base.DirtyPrice,
+		BaseMDuration: base.MDuration,
+		IndexRatio:    1,
+	}
+
+	growth := extendIndex
+	if g, ok := sc.IndexGrowth[strings.ToUpper(b.Index)]; ok {
+		growth = g
+	}
+	ratioAt := func(d time.Time) (float64, error) {
+		if b.Index == "" {
+			return 1, nil
+		}
+		adj, err := md.indexRatio(b, d, growth)
+		if err != nil {
+			return 0, err
+		}
+		return adj.ratio * (1 + sc.IndexShock[strings.ToUpper(b.Index)]), nil
+	}
+
+	flow, err := md.cashflow(b)
+	if err != nil {
+		return sp, err
+	}
+	_, entitled, err := md.entitlement(b, flow, settlementDate)
+	if err != nil {
+		return sp, err
+	}
+	_, atHorizon, err := md.entitlement(b, flow, horizon)
+	if err != nil {
+		return sp, err
+	}
+
+	// lo cobrado entre la liquidación y el horizonte
+	due := map[time.Time]bool{}
+	for _, cf := range atHorizon {
+		due[time.Time(cf.Date)] = true
+	}
+	for _, cf := range entitled {
+		d := time.Time(cf.Date)
+		if d.Before(settlementDate) || due[d] {
+			continue
+		}
+		r, err := ratioAt(d)
+		if err != nil {
+			return sp, fmt.Errorf("payment of %s: %w", d.Format(DateFormat), err)
+		}
+		sp.Coupons += cf.Amount * r
+	}
+
+	remaining := false
+	for _, cf := range atHorizon {
+		if !time.Time(cf.Date).Before(horizon) {
+			remaining = true
+			break
+		}
+	}
+	if remaining {
+		if sp.IndexRatio, err = ratioAt(horizon); err != nil {
+			return sp, err
+		}
+		p, err, _ := Price(atHorizon, sp.Yield, horizon, 0, 0)
+		if err != nil {
+			return sp, fmt.Errorf("price: %w", err)
+		}
+		if sp.MDuration, err = Mduration(atHorizon, sp.Yield, horizon, 0, 0, p); err != nil {
+			return sp, fmt.Errorf("modified duration: %w", err)
+		}
+		sp.Price = p * sp.IndexRatio
+	}
+	sp.Value = pos.Nominal / 100 * (sp.Price + sp.Coupons)
+	return sp, nil
+}
+
+// runScenarios values the positions with valuePositions and revalues them under each scenario.
+func runScenarios(c *gin.Context, name string, positions []Position, list []Scenario) {
+	if len(list) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no scenarios, add them with PUT /scenarios/:name"})
+		return
+	}
+	v, err := valuePositions(c, positions)
+	if err != nil {
+		c.JSON(indexErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	md, settlementDate, values := v.md, v.settlementDate, v.values
+	baseTotal := portfolioBucket{}
+	for _, pv := range values {
+		baseTotal.add(pv)
+	}
+	baseTotal.finish(baseTotal.MarketValue)
+
+	var results []scenarioResult
+	for _, sc := range list {
+		res := scenarioResult{Scenario: sc.Name, Description: sc.Description, Horizon: Fecha(settlementDate.AddDate(0, 0, sc.HorizonDays))}
+		var weightedYield, weightedDuration float64
+		for i, pos := range positions {
+			_, index, _ := getCashFlow(v.bonds, pos.Ticker)
+			// cada posición se revalúa desde la fecha en que liquidó su bono
+			sp, err := md.revalue(v.bonds[index], pos, values[i], sc, time.Time(values[i].SettlementDate), v.extendIndex)
+			if err != nil {
+				c.JSON(indexErrorStatus(err), gin.H{"error": sc.Name + ": " + pos.Ticker + ": " + err.Error()})
+				return
+			}
+			rate := values[i].fx
+			if pos.Currency != v.base {
+				rate *= 1 + sc.FXShock[pos.Currency]
+			}
+			sp.BaseValue = values[i].MarketValueBase
+			sp.Value *= rate
+			sp.PnL = sp.Value - sp.BaseValue
+			res.MarketValue += sp.Value
+			res.PnL += sp.PnL
+			weightedYield += sp.Yield * sp.Value
+			weightedDuration += sp.MDuration * sp.Value
+			res.Positions = append(res.Positions, sp)
+		}
+		if res.MarketValue != 0 {
+			res.Yield = weightedYield / res.MarketValue
+			res.MDuration = weightedDuration / res.MarketValue
+		}
+		if baseTotal.MarketValue != 0 {
+			res.PnLPct = res.PnL / baseTotal.MarketValue
+		}
+		results = append(results, res)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"Name":           name,
+		"SettlementDate": Fecha(settlementDate),
+		"BaseCurrency":   v.base,
+		"Base": gin.H{
+			"MarketValue": baseTotal.MarketValue,
+			"Yield":       baseTotal.Yield,
+			"MDuration":   baseTotal.MDuration,
+			"DV01":        baseTotal.DV01,
+			"Positions":   values,
+		},
+		"Scenarios":  results,
+		"MarketData": md,
+	})
+}
+
+// scenariosFromQuery returns the stored scenarios named by the scenario params, or all of them if there are none.
+func scenariosFromQuery(c *gin.Context) ([]Scenario, error) {
+	names := c.QueryArray("scenario")
+	if len(names) == 0 {
+		return scenarios.List()
+	}
+	var out []Scenario
+	for _, name := range names {
+		sc, ok, err := scenarios.Get(name)
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, fmt.Errorf("scenario %q not found", name)
+		}
+		out = append(out, sc)
+	}
+	return out, nil
+}
+
+// bondScenariosWrapper revalues nominal (100 by default) of one bond at price under the scenarios.
+func bondScenariosWrapper(c *gin.Context) {
+	ticker := strings.ToUpper(c.Query("ticker"))
+	price, err := strconv.ParseFloat(c.Query("price"), 64)
+	if err != nil || price <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "price should be a number greater than 0"})
+		return
+	}
+	nominal := 100.0
+	if s := c.Query("nominal"); s != "" {
+		if nominal, err = strconv.ParseFloat(s, 64); err != nil || nominal <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "nominal should be a number greater than 0"})
+			return
+		}
+	}
+	list, err := scenariosFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	pos := Position{Ticker: ticker, Nominal: nominal, Price: price, PriceType: c.Query("priceType"), Currency: c.Query("currency")}
+	runScenarios(c, ticker, []Position{pos}, list)
+}
+
+// portfolioScenariosWrapper revalues a stored portfolio under the scenarios.
+func portfolioScenariosWrapper(c *gin.Context) {
+	p, ok, err := portfolios.Get(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	} else if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "portfolio not found"})
+		return
+	}
+	list, err := scenariosFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	runScenarios(c, p.Name, p.Positions, list)
+}
+
+// adhocScenariosWrapper revalues the positions of the body under the stored scenarios of the query
+// and the ones of the body: {"Positions": [...], "Scenarios": [...]}.
+func adhocScenariosWrapper(c *gin.Context) {
+	var body struct {
+		Name      string
+		Positions []Position
+		Scenarios []Scenario
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var list []Scenario
+	if len(c.QueryArray("scenario")) > 0 || len(body.Scenarios) == 0 {
+		stored, err := scenariosFromQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		list = stored
+	}
+	for _, sc := range body.Scenarios {
+		normalizeScenario(&sc)
+		if err := validateScenario(sc); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": sc.Name + ": " + err.Error()})
+			return
+		}
+		list = append(list, sc)
+	}
+	runScenarios(c, body.Name, body.Positions, list)
+}
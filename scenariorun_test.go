@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A scenario without shocks and without horizon gives back the valuation of the portfolio, and a rise of the yields loses.
+func TestRunScenarios(t *testing.T) {
+	setTestMarket(t, []Bond{cerBond, tenPercentBond("PLN")}, dailyCER("2023-12-01", "2024-06-30"), nil)
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/portfolios/scenarios?settlementDate=2024-05-15&prices=TXT1:105,PLN:98&baseCurrency=ARS&fx=USD:1000", nil)
+	positions := []Position{{Ticker: "TXT1", Nominal: 1000}, {Ticker: "PLN", Nominal: 100}}
+	runScenarios(c, "", positions, []Scenario{{Name: "base"}, {Name: "up", ShiftBp: 100}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var out struct {
+		Base struct {
+			MarketValue float64
+			Yield       float64
+		}
+		Scenarios []scenarioResult
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Scenarios) != 2 {
+		t.Fatalf("%d results, want 2", len(out.Scenarios))
+	}
+
+	base := out.Scenarios[0]
+	if math.Abs(base.MarketValue-out.Base.MarketValue) > 1e-6*out.Base.MarketValue || math.Abs(base.PnL) > 1e-6*out.Base.MarketValue {
+		t.Errorf("no shocks: market value %v PnL %v, want %v and 0", base.MarketValue, base.PnL, out.Base.MarketValue)
+	}
+	if math.Abs(base.Yield-out.Base.Yield) > 1e-9 {
+		t.Errorf("no shocks: yield %v, want %v", base.Yield, out.Base.Yield)
+	}
+	for _, sp := range base.Positions {
+		if math.Abs(sp.Value-sp.BaseValue) > 1e-6*sp.BaseValue || sp.Coupons != 0 || sp.ShiftBp != 0 {
+			t.Errorf("%s without shocks: value %v base %v coupons %v", sp.Ticker, sp.Value, sp.BaseValue, sp.Coupons)
+		}
+	}
+
+	up := out.Scenarios[1]
+	if up.PnL >= 0 || up.PnLPct >= 0 {
+		t.Errorf("+100bp: PnL %v", up.PnL)
+	}
+	for _, sp := range up.Positions {
+		if sp.ShiftBp != 100 || sp.PnL >= 0 {
+			t.Errorf("%s +100bp: shift %v PnL %v", sp.Ticker, sp.ShiftBp, sp.PnL)
+		}
+	}
+}
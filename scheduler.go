@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Default schedules of the refresh jobs. They can be overridden with <JOB>_SCHEDULE, e.g. CER_SCHEDULE="30 19 * * 1-5".
+const (
+	defaultCERSchedule      = "0 19 * * *" // el BCRA publica el CER por la tarde
+	defaultUVASchedule      = "0 19 * * *" // la UVA se publica junto con el CER
+	defaultHolidaysSchedule = "0 6 * * 1"  // semanal, lunes temprano
+	defaultSchedulerJitter  = time.Minute
+)
+
+// cronSpec is a parsed standard 5 field cron expression: minute hour day-of-month month day-of-week.
+type cronSpec struct {
+	expr   string
+	minute [60]bool
+	hour   [24]bool
+	dom    [32]bool
+	month  [13]bool
+	dow    [7]bool
+	// como en cron, si ambos campos de día están restringidos alcanza con que coincida uno
+	domStar bool
+	dowStar bool
+}
+
+func parseCron(expr string) (*cronSpec, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron %q: expected 5 fields", expr)
+	}
+	s := &cronSpec{expr: expr, domStar: fields[2] == "*", dowStar: fields[4] == "*"}
+	if err := parseCronField(fields[0], 0, 59, s.minute[:]); err != nil {
+		return nil, fmt.Errorf("cron %q minute: %w", expr, err)
+	}
+	if err := parseCronField(fields[1], 0, 23, s.hour[:]); err != nil {
+		return nil, fmt.Errorf("cron %q hour: %w", expr, err)
+	}
+	if err := parseCronField(fields[2], 1, 31, s.dom[:]); err != nil {
+		return nil, fmt.Errorf("cron %q day of month: %w", expr, err)
+	}
+	if err := parseCronField(fields[3], 1, 12, s.month[:]); err != nil {
+		return nil, fmt.Errorf("cron %q month: %w", expr, err)
+	}
+	// 7 también es domingo
+	var dow [8]bool
+	if err := parseCronField(fields[4], 0, 7, dow[:]); err != nil {
+		return nil, fmt.Errorf("cron %q day of week: %w", expr, err)
+	}
+	copy(s.dow[:], dow[:7])
+	s.dow[0] = s.dow[0] || dow[7]
+	return s, nil
+}
+
+// parseCronField accepts *, n, a-b, lists separated by commas and steps (*/n, a-b/n).
+func parseCronField(field string, min int, max int, set []bool) error {
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid step %q", part)
+			}
+			step = n
+			part = part[:i]
+		}
+		lo, hi := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return fmt.Errorf("invalid value %q", part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return fmt.Errorf("invalid value %q", part)
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return nil
+}
+
+func (s *cronSpec) dayMatches(t time.Time) bool {
+	dom := s.dom[t.Day()]
+	dow := s.dow[int(t.Weekday())]
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first time strictly after t that matches the expression, in t's location.
+func (s *cronSpec) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// cinco años alcanzan para cualquier expresión válida (ej. 29 de febrero)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if !s.month[int(t.Month())] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.hour[t.Hour()] {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.minute[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// jobStatus is what the admin endpoint reports about a job.
+type jobStatus struct {
+	Name         string
+	Schedule     string
+	Running      bool
+	NextRun      *time.Time `json:",omitempty"`
+	LastRun      *time.Time `json:",omitempty"`
+	LastDuration string     `json:",omitempty"`
+	LastError    string     `json:",omitempty"`
+	Rows         int
+	Runs         int
+}
+
+// job is a data refresh run by the scheduler. run returns how many rows were loaded.
+type job struct {
+	name string
+	spec *cronSpec
+	run  func(ctx context.Context) (int, error)
+
+	mu     sync.Mutex // serializes the runs of the job
+	status jobStatus
+	smu    sync.RWMutex // guards status
+}
+
+// scheduler runs every refresh job of the service on its own cron schedule.
+type scheduler struct {
+	jobs   map[string]*job
+	loc    *time.Location
+	jitter time.Duration
+}
+
+var errUnknownJob = errors.New("unknown job")
+
+// Scheduler of the service. Set up in main by newScheduler.
+var jobs *scheduler
+
+func newScheduler(loc *time.Location, jitter time.Duration) *scheduler {
+	return &scheduler{jobs: make(map[string]*job), loc: loc, jitter: jitter}
+}
+
+// Add registers a job. The schedule is read from <NAME>_SCHEDULE and falls back to defaultSpec.
+func (s *scheduler) Add(name string, defaultSpec string, run func(ctx context.Context) (int, error)) error {
+	expr := os.Getenv(strings.ToUpper(name) + "_SCHEDULE")
+	if expr == "" {
+		expr = defaultSpec
+	}
+	spec, err := parseCron(expr)
+	if err != nil {
+		return err
+	}
+	s.jobs[name] = &job{name: name, spec: spec, run: run, status: jobStatus{Name: name, Schedule: expr}}
+	return nil
+}
+
+// Start launches one goroutine per job that waits for the next scheduled time (plus a random jitter) and runs it.
+func (s *scheduler) Start(ctx context.Context) {
+	for _, j := range s.jobs {
+		go s.loop(ctx, j)
+	}
+}
+
+func (s *scheduler) loop(ctx context.Context, j *job) {
+	for {
+		next := j.spec.Next(time.Now().In(s.loc))
+		if next.IsZero() {
+			fmt.Println("Job", j.name, "no tiene próxima ejecución")
+			return
+		}
+		j.smu.Lock()
+		j.status.NextRun = &next
+		j.smu.Unlock()
+
+		wait := time.Until(next)
+		if s.jitter > 0 {
+			wait += time.Duration(rand.Int63n(int64(s.jitter)))
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+		if _, err := s.execute(ctx, j); err != nil {
+			fmt.Println("Job", j.name, "falló:", err)
+		}
+	}
+}
+
+// execute runs a job now and records the result. Runs of the same job never overlap.
+func (s *scheduler) execute(ctx context.Context, j *job) (jobStatus, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	start := time.Now()
+	j.smu.Lock()
+	j.status.Running = true
+	j.smu.Unlock()
+
+	rows, err := j.run(ctx)
+
+	j.smu.Lock()
+	defer j.smu.Unlock()
+	j.status.Running = false
+	j.status.LastRun = &start
+	j.status.LastDuration = time.Since(start).Round(time.Millisecond).String()
+	j.status.Runs++
+	if err != nil {
+		j.status.LastError = err.Error()
+	} else {
+		j.status.LastError = ""
+		j.status.Rows = rows
+	}
+	return j.status, err
+}
+
+// Trigger runs the job on demand, outside of its schedule.
+func (s *scheduler) Trigger(ctx context.Context, name string) (jobStatus, error) {
+	j, ok := s.jobs[name]
+	if !ok {
+		return jobStatus{}, errUnknownJob
+	}
+	return s.execute(ctx, j)
+}
+
+func (s *scheduler) Status() []jobStatus {
+	out := make([]jobStatus, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		j.smu.RLock()
+		out = append(out, j.status)
+		j.smu.RUnlock()
+	}
+	sort.Slice(out, func(i, k int) bool { return out[i].Name < out[k].Name })
+	return out
+}
+
+// Zona horaria de los schedules: SCHEDULER_TZ o Buenos Aires; si no está la base de zonas, la local.
+func schedulerLocation() *time.Location {
+	name := os.Getenv("SCHEDULER_TZ")
+	if name == "" {
+		name = "America/Argentina/Buenos_Aires"
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		fmt.Println("Zona horaria", name, "no disponible, uso la local:", err)
+		return time.Local
+	}
+	return loc
+}
+
+// Jitter máximo que se suma a cada ejecución: SCHEDULER_JITTER (ej. "5m") o el default.
+func schedulerJitter() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("SCHEDULER_JITTER")); err == nil && d >= 0 {
+		return d
+	}
+	return defaultSchedulerJitter
+}
+
+func jobsWrapper(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"jobs": jobs.Status(),
+	})
+}
+
+func runJobWrapper(c *gin.Context) {
+	status, err := jobs.Trigger(c.Request.Context(), c.Param("name"))
+	if err == errUnknownJob {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown job " + c.Param("name")})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "job": status})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"job": status})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseCronField(t *testing.T) {
+	tests := []struct {
+		field    string
+		min, max int
+		want     []int // values set, nil if the field is rejected
+	}{
+		{"*", 0, 5, []int{0, 1, 2, 3, 4, 5}},
+		{"3", 0, 5, []int{3}},
+		{"1-3", 0, 5, []int{1, 2, 3}},
+		{"0,2,5", 0, 5, []int{0, 2, 5}},
+		{"1-2,4", 0, 5, []int{1, 2, 4}},
+		{"*/2", 0, 5, []int{0, 2, 4}},
+		{"1-5/2", 0, 5, []int{1, 3, 5}},
+		{"2/3", 0, 10, []int{2, 5, 8}},
+		{"*/15", 0, 59, []int{0, 15, 30, 45}},
+		{"6", 0, 5, nil},
+		{"0", 1, 12, nil},
+		{"13", 1, 12, nil},
+		{"4-2", 0, 5, nil},
+		{"1-6", 0, 5, nil},
+		{"*/0", 0, 5, nil},
+		{"*/x", 0, 5, nil},
+		{"a", 0, 5, nil},
+		{"1-b", 0, 5, nil},
+		{"", 0, 5, nil},
+	}
+	for _, tt := range tests {
+		set := make([]bool, tt.max+1)
+		err := parseCronField(tt.field, tt.min, tt.max, set)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%q in %d-%d: want an error", tt.field, tt.min, tt.max)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q in %d-%d: %v", tt.field, tt.min, tt.max, err)
+			continue
+		}
+		var got []int
+		for v, ok := range set {
+			if ok {
+				got = append(got, v)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q in %d-%d: got %v, want %v", tt.field, tt.min, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"0 19 * *",     // faltan campos
+		"0 19 * * * *", // sobran
+		"60 19 * * *",
+		"0 24 * * *",
+		"0 19 0 * *",
+		"0 19 32 * *",
+		"0 19 * 13 *",
+		"0 19 * * 8",
+	} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q): want an error", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	at := func(s string) time.Time {
+		d, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			panic(err)
+		}
+		return d
+	}
+	tests := []struct {
+		name string
+		expr string
+		from string
+		want string // "" if the expression never matches
+	}{
+		{"later today", "0 19 * * *", "2024-06-10 08:30", "2024-06-10 19:00"},
+		{"strictly after", "0 19 * * *", "2024-06-10 19:00", "2024-06-11 19:00"},
+		{"seconds are dropped", "*/15 * * * *", "2024-06-10 10:14", "2024-06-10 10:15"},
+		{"list of hours", "30 9,17 * * *", "2024-06-10 10:00", "2024-06-10 17:30"},
+		{"day of week", "0 6 * * 1", "2024-06-12 00:00", "2024-06-17 06:00"},
+		{"sunday is 0 and 7", "0 6 * * 7", "2024-06-12 00:00", "2024-06-16 06:00"},
+		{"weekdays range", "0 19 * * 1-5", "2024-06-14 20:00", "2024-06-17 19:00"},
+		{"across month-end", "0 0 1 * *", "2024-01-31 12:00", "2024-02-01 00:00"},
+		{"31st skips short months", "0 0 31 * *", "2024-04-01 00:00", "2024-05-31 00:00"},
+		{"Feb 29 of the next leap year", "0 0 29 2 *", "2024-03-01 00:00", "2028-02-29 00:00"},
+		{"Feb 29 in a leap year", "0 12 29 2 *", "2024-02-28 13:00", "2024-02-29 12:00"},
+		{"across year-end", "0 0 * * *", "2024-12-31 23:59", "2025-01-01 00:00"},
+		{"first of the year", "0 0 1 1 *", "2024-01-01 00:00", "2025-01-01 00:00"},
+		// con ambos días restringidos alcanza con que coincida uno: el 13 o cualquier viernes
+		{"day of month or week, the weekday first", "0 0 13 * 5", "2024-09-01 00:00", "2024-09-06 00:00"},
+		{"day of month or week, the day first", "0 0 13 * 5", "2024-09-07 00:00", "2024-09-13 00:00"},
+		{"day of month or week, not a friday", "0 0 10 * 5", "2024-09-07 00:00", "2024-09-10 00:00"},
+		// con uno de los dos en * tienen que coincidir ambos
+		{"day of month and any weekday", "0 0 13 * *", "2024-09-07 00:00", "2024-09-13 00:00"},
+		{"never", "0 0 30 2 *", "2024-01-01 00:00", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := s.Next(at(tt.from))
+			if tt.want == "" {
+				if !got.IsZero() {
+					t.Errorf("Next = %s, want none", got.Format("2006-01-02 15:04"))
+				}
+				return
+			}
+			if !got.Equal(at(tt.want)) {
+				t.Errorf("Next = %s, want %s", got.Format("2006-01-02 15:04 Mon"), tt.want)
+			}
+		})
+	}
+}
+
+// Next works in the location of t: the jobs are scheduled in Buenos Aires time by default.
+func TestCronNextLocation(t *testing.T) {
+	art := time.FixedZone("ART", -3*3600)
+	s, err := parseCron("0 19 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 21:00 UTC ya pasó las 19 en UTC pero son las 18 en Buenos Aires
+	if got, want := s.Next(time.Date(2024, 6, 10, 21, 0, 0, 0, time.UTC).In(art)), time.Date(2024, 6, 10, 19, 0, 0, 0, art); !got.Equal(want) {
+		t.Errorf("Next = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseSettlementTerm returns the number of business days of a settlement term:
+// CI / T+0 / 0, T+1 / 24hs / 1, T+2 / 48hs / 2, and in general T+n.
+func parseSettlementTerm(term string) (int, error) {
+	t := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(term), " ", ""))
+	switch t {
+	case "CI", "CONTADO", "T0":
+		return 0, nil
+	case "24HS", "24H":
+		return 1, nil
+	case "48HS", "48H":
+		return 2, nil
+	case "72HS", "72H":
+		return 3, nil
+	}
+	t = strings.TrimPrefix(t, "T+")
+	n, err := strconv.Atoi(t)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid settlementTerm %q, use CI, T+1, T+2, ...", term)
+	}
+	return n, nil
+}
+
+// settlementCalendar is the calendar used to settle a bond paying on bondCalendar.
+// Trades settle in Argentina, so bonds paying in New York need both markets open.
+func settlementCalendar(bondCalendar string) (string, error) {
+	name, err := normalizeCalendar(bondCalendar)
+	if err != nil {
+		return "", err
+	}
+	if name == CalendarAR {
+		return CalendarAR, nil
+	}
+	return CalendarARandNY, nil
+}
+
+// settlementDate adds term business days of calendarName to tradeDate, on the calendars of md so a
+// request settles with the holidays it values with. A trade date that is not a business day is moved
+// to the next one first.
+func (md *marketData) settlementDate(tradeDate time.Time, term int, calendarName string) (time.Time, error) {
+	c, err := md.calendar(calendarName)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !c.IsWorkday(tradeDate) {
+		tradeDate = c.WorkdaysFrom(tradeDate, 1)
+	}
+	return c.WorkdaysFrom(tradeDate, term), nil
+}
+
+// settlementDateFromQuery returns settlementDate if it was given, otherwise it computes it from
+// tradeDate and settlementTerm on the settlement calendar of ticker. The bond and the calendars are
+// the ones the request values with (bondVersion, asOf).
+func settlementDateFromQuery(c *gin.Context, ticker string, bonds []Bond, md *marketData) (time.Time, error) {
+	if settle := c.Query("settlementDate"); settle != "" {
+		d, err := time.Parse(DateFormat, settle)
+		if err != nil {
+			return time.Time{}, errors.New("Invalid date format")
+		}
+		return d, nil
+	}
+	trade := c.Query("tradeDate")
+	if trade == "" {
+		return time.Time{}, errors.New("settlementDate or tradeDate and settlementTerm are required")
+	}
+	tradeDate, err := time.Parse(DateFormat, trade)
+	if err != nil {
+		return time.Time{}, errors.New("Invalid tradeDate format")
+	}
+	term, err := parseSettlementTerm(c.DefaultQuery("settlementTerm", "T+1"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	calendarName := CalendarAR
+	if _, index, err := getCashFlow(bonds, ticker); err == nil {
+		if calendarName, err = settlementCalendar(bonds[index].Calendar); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return md.settlementDate(tradeDate, term, calendarName)
+}
+
+// settlementWrapper computes the settlement date of a trade. The calendar is taken from the ticker
+// if given, otherwise from the calendar param (AR by default), with the holidays of asOf if given.
+func settlementWrapper(c *gin.Context) {
+	tradeDate, err := time.Parse(DateFormat, c.Query("tradeDate"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tradeDate"})
+		return
+	}
+	termParam := c.DefaultQuery("settlementTerm", "T+1")
+	term, err := parseSettlementTerm(termParam)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	bondCalendar := c.Query("calendar")
+	if ticker := strings.ToUpper(c.Query("ticker")); ticker != "" {
+		bonds, err := bondsForRequest(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		_, index, err := getCashFlow(bonds, ticker)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "ticker not found"})
+			return
+		}
+		bondCalendar = bonds[index].Calendar
+	}
+	calendarName, err := settlementCalendar(bondCalendar)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	md, err := marketDataForRequest(c)
+	if err != nil {
+		c.JSON(indexErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	settlementDate, err := md.settlementDate(tradeDate, term, calendarName)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"TradeDate":      Fecha(tradeDate),
+		"SettlementTerm": termParam,
+		"Calendar":       calendarName,
+		"SettlementDate": Fecha(settlementDate),
+	})
+}
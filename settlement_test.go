@@ -0,0 +1,139 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// arHolidays2024 are the Argentine holidays of June 2024: Monday 17, Thursday 20 and the bridge of Friday 21.
+var arHolidays2024 = []time.Time{mustDate("2024-06-17"), mustDate("2024-06-20"), mustDate("2024-06-21")}
+
+func TestParseSettlementTerm(t *testing.T) {
+	tests := []struct {
+		term    string
+		want    int
+		wantErr bool
+	}{
+		{"CI", 0, false},
+		{"contado", 0, false},
+		{"T+0", 0, false},
+		{"0", 0, false},
+		{"T+1", 1, false},
+		{"t + 1", 1, false},
+		{"24hs", 1, false},
+		{"48HS", 2, false},
+		{"72h", 3, false},
+		{"T+5", 5, false},
+		{"T-1", 0, true},
+		{"T+", 0, true},
+		{"mañana", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseSettlementTerm(tt.term)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseSettlementTerm(%q) = %d, %v, want %d", tt.term, got, err, tt.want)
+		}
+	}
+}
+
+func TestSettlementDate(t *testing.T) {
+	md := &marketData{calendars: buildCalendars(arHolidays2024)}
+	tests := []struct {
+		name     string
+		trade    string
+		term     int
+		calendar string
+		want     string
+	}{
+		{"T+1 on the Friday before a holiday Monday", "2024-06-14", 1, CalendarAR, "2024-06-18"},
+		{"T+2 across the holiday Monday", "2024-06-13", 2, CalendarAR, "2024-06-18"},
+		{"T+0 on a business day", "2024-06-18", 0, CalendarAR, "2024-06-18"},
+		{"trade on a Saturday moves to the next business day", "2024-06-15", 0, CalendarAR, "2024-06-18"},
+		{"trade on a holiday moves to the next business day", "2024-06-17", 1, CalendarAR, "2024-06-19"},
+		{"Juneteenth is a business day in Argentina", "2024-06-18", 1, CalendarAR, "2024-06-19"},
+		// AR+NY necesita ambos mercados abiertos: el 19 cierra Nueva York y el 20 y 21 Argentina
+		{"AR+NY skips the holidays of both", "2024-06-18", 1, CalendarARandNY, "2024-06-24"},
+		{"AR+NY skips Independence Day", "2024-07-03", 1, CalendarARandNY, "2024-07-05"},
+		{"NY alone ignores the Argentine holidays", "2024-06-19", 1, CalendarNY, "2024-06-21"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := md.settlementDate(mustDate(tt.trade), tt.term, tt.calendar)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Format(DateFormat) != tt.want {
+				t.Errorf("got %s, want %s", got.Format("2006-01-02 Mon"), tt.want)
+			}
+		})
+	}
+	if _, err := md.settlementDate(mustDate("2024-06-14"), 1, "Tokyo"); err == nil {
+		t.Error("unknown calendar: want an error")
+	}
+}
+
+func TestSettlementCalendar(t *testing.T) {
+	tests := []struct {
+		bond    string
+		want    string
+		wantErr bool
+	}{
+		{"", CalendarAR, false},
+		{"AR", CalendarAR, false},
+		{"NY", CalendarARandNY, false},
+		{"AR+NY", CalendarARandNY, false},
+		{"LSE", "", true},
+	}
+	for _, tt := range tests {
+		got, err := settlementCalendar(tt.bond)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("settlementCalendar(%q) = %q, %v, want %q", tt.bond, got, err, tt.want)
+		}
+	}
+}
+
+func TestSettlementDateFromQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	md := &marketData{calendars: buildCalendars(arHolidays2024)}
+	ny := tenPercentBond("GDX")
+	ny.Calendar = "NY"
+	bonds := []Bond{tenPercentBond("ALX"), ny}
+	tests := []struct {
+		name    string
+		query   string
+		want    string
+		wantErr bool
+	}{
+		{"settlementDate wins", "?ticker=ALX&settlementDate=2024-06-17&tradeDate=2024-06-14", "2024-06-17", false},
+		{"T+1 by default", "?ticker=ALX&tradeDate=2024-06-14", "2024-06-18", false},
+		{"the term given", "?ticker=ALX&tradeDate=2024-06-14&settlementTerm=CI", "2024-06-14", false},
+		{"a NY bond settles on AR+NY", "?ticker=GDX&tradeDate=2024-06-18", "2024-06-24", false},
+		{"an unknown ticker settles on AR", "?ticker=ZZZ&tradeDate=2024-06-18", "2024-06-19", false},
+		{"no dates", "?ticker=ALX", "", true},
+		{"bad trade date", "?ticker=ALX&tradeDate=14/06/2024", "", true},
+		{"bad term", "?ticker=ALX&tradeDate=2024-06-14&settlementTerm=T-1", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/yield"+tt.query, nil)
+			got, err := settlementDateFromQuery(c, c.Query("ticker"), bonds, md)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %s, want an error", got.Format(DateFormat))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Format(DateFormat) != tt.want {
+				t.Errorf("got %s, want %s", got.Format(DateFormat), tt.want)
+			}
+		})
+	}
+}
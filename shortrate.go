@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Short rate models of the binomial tree.
+const (
+	ModelHoLee = "holee" // normal: r = a(i) + sigma*sqrt(dt)*(2j-i), sigma in absolute terms (e.g. 0.01)
+	ModelBDT   = "bdt"   // Black-Derman-Toy, lognormal: r = a(i)*exp(sigma*sqrt(dt)*(2j-i)), sigma relative (e.g. 0.2)
+)
+
+// Volatilidad por defecto de cada modelo.
+const (
+	defaultHoLeeVolatility = 0.01
+	defaultBDTVolatility   = 0.2
+)
+
+// zeroCurve is a curve of annually compounded zero rates by tenor in years, linearly interpolated
+// and flat outside its tenors, so that the discount factor of t is (1+z(t))^-t as in Price.
+type zeroCurve struct {
+	tenors []float64
+	rates  []float64
+}
+
+// parseZeroCurve reads a curve as "tenor:rate,tenor:rate", e.g. "0.5:0.30,1:0.32,5:0.35".
+func parseZeroCurve(s string) (*zeroCurve, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, errors.New("curve is required, as tenor:rate,tenor:rate with tenors in years")
+	}
+	type point struct{ t, r float64 }
+	var points []point
+	for _, part := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid curve point %q, use tenor:rate", part)
+		}
+		t, err1 := strconv.ParseFloat(kv[0], 64)
+		r, err2 := strconv.ParseFloat(kv[1], 64)
+		if err1 != nil || err2 != nil || t <= 0 || r <= -1 {
+			return nil, fmt.Errorf("invalid curve point %q, use tenor:rate", part)
+		}
+		points = append(points, point{t, r})
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].t < points[j].t })
+	z := &zeroCurve{}
+	for i, p := range points {
+		if i > 0 && p.t == points[i-1].t {
+			return nil, fmt.Errorf("tenor %v is repeated in the curve", p.t)
+		}
+		z.tenors = append(z.tenors, p.t)
+		z.rates = append(z.rates, p.r)
+	}
+	return z, nil
+}
+
+func (z *zeroCurve) rate(t float64) float64 {
+	n := len(z.tenors)
+	if t <= z.tenors[0] {
+		return z.rates[0]
+	}
+	if t >= z.tenors[n-1] {
+		return z.rates[n-1]
+	}
+	i := sort.SearchFloat64s(z.tenors, t)
+	w := (t - z.tenors[i-1]) / (z.tenors[i] - z.tenors[i-1])
+	return z.rates[i-1] + w*(z.rates[i]-z.rates[i-1])
+}
+
+func (z *zeroCurve) discount(t float64) float64 {
+	return math.Pow(1+z.rate(t), -t)
+}
+
+// shifted returns the curve moved in parallel by shift (e.g. 0.0025 for 25bp).
+func (z *zeroCurve) shifted(shift float64) *zeroCurve {
+	out := &zeroCurve{tenors: z.tenors, rates: make([]float64, len(z.rates))}
+	for i, r := range z.rates {
+		out.rates[i] = r + shift
+	}
+	return out
+}
+
+// normalizeModel maps the model param to ModelHoLee (default) or ModelBDT.
+func normalizeModel(model string) (string, error) {
+	switch strings.ToLower(strings.ReplaceAll(strings.TrimSpace(model), "-", "")) {
+	case "", ModelHoLee:
+		return ModelHoLee, nil
+	case ModelBDT, "blackdermantoy":
+		return ModelBDT, nil
+	}
+	return "", fmt.Errorf("unknown model %q, use holee or bdt", model)
+}
+
+// shortRateTree is a recombining binomial tree of the short rate (continuously compounded, per year)
+// with n steps of dt years and probability 1/2 on each branch. Node (i, j) is step i after j up moves.
+// The level a(i) of each step is calibrated so the tree reprices the zero coupon bonds of the curve.
+type shortRateTree struct {
+	model string
+	sigma float64
+	dt    float64
+	n     int
+	a     []float64
+}
+
+// Límites de la calibración del BDT y de la búsqueda del OAS.
+const (
+	treeSolveIter = 200
+	treeSolveTol  = 1e-12
+)
+
+func (t *shortRateTree) rate(i int, j int) float64 {
+	x := t.sigma * math.Sqrt(t.dt) * float64(2*j-i)
+	if t.model == ModelBDT {
+		return t.a[i] * math.Exp(x)
+	}
+	return t.a[i] + x
+}
+
+// newShortRateTree calibrates a tree of n steps up to horizon years to the zero curve, using the
+// state prices (Arrow-Debreu) of each step: sum_j Q(i,j) exp(-r(i,j) dt) = P((i+1) dt).
+func newShortRateTree(model string, curve *zeroCurve, sigma float64, horizon float64, n int) (*shortRateTree, error) {
+	if n < 1 || horizon <= 0 {
+		return nil, errors.New("the tree needs at least one step and a positive horizon")
+	}
+	t := &shortRateTree{model: model, sigma: sigma, dt: horizon / float64(n), n: n, a: make([]float64, n)}
+	q := []float64{1}
+	for i := 0; i < n; i++ {
+		target := curve.discount(float64(i+1) * t.dt)
+		switch model {
+		case ModelHoLee:
+			// con r = a + x(j) la ecuación se despeja: a = ln(sum Q e^{-x dt} / P) / dt
+			sum := 0.0
+			for j := range q {
+				sum += q[j] * math.Exp(-t.sigma*math.Sqrt(t.dt)*float64(2*j-i)*t.dt)
+			}
+			t.a[i] = math.Log(sum/target) / t.dt
+		case ModelBDT:
+			price := func(a float64) float64 {
+				t.a[i] = a
+				sum := 0.0
+				for j := range q {
+					sum += q[j] * math.Exp(-t.rate(i, j)*t.dt)
+				}
+				return sum
+			}
+			lo, hi := 0.0, 1.0
+			for price(hi) > target && hi < 1e3 {
+				hi *= 2
+			}
+			if price(lo) < target || price(hi) > target {
+				return nil, fmt.Errorf("can't calibrate the BDT tree at step %d: the curve implies negative rates", i)
+			}
+			for k := 0; k < treeSolveIter && hi-lo > treeSolveTol; k++ {
+				mid := (lo + hi) / 2
+				if price(mid) > target {
+					lo = mid
+				} else {
+					hi = mid
+				}
+			}
+			t.a[i] = (lo + hi) / 2
+		default:
+			return nil, fmt.Errorf("unknown model %q", model)
+		}
+
+		next := make([]float64, i+2)
+		for j := range q {
+			d := q[j] * math.Exp(-t.rate(i, j)*t.dt) / 2
+			next[j] += d
+			next[j+1] += d
+		}
+		q = next
+	}
+	return t, nil
+}
+
+// treeCashflow is a bond laid on the steps of a tree: the payment of each step and, on call and
+// put dates, the amount paid if the bond is redeemed there (NaN if it can't be).
+type treeCashflow struct {
+	pay  []float64
+	call []float64
+	put  []float64
+}
+
+func newTreeCashflow(n int) treeCashflow {
+	cf := treeCashflow{pay: make([]float64, n+1), call: make([]float64, n+1), put: make([]float64, n+1)}
+	for i := range cf.call {
+		cf.call[i], cf.put[i] = math.NaN(), math.NaN()
+	}
+	return cf
+}
+
+// value discounts the cashflow backwards through the tree with every short rate raised by spread.
+// With options the issuer calls when the bond is worth more than the call amount and the holder puts
+// when it is worth less than the put amount.
+func (t *shortRateTree) value(cf treeCashflow, spread float64, options bool) float64 {
+	v := make([]float64, t.n+1)
+	for j := range v {
+		v[j] = cf.pay[t.n]
+	}
+	for i := t.n - 1; i >= 0; i-- {
+		for j := 0; j <= i; j++ {
+			hold := cf.pay[i] + (v[j]+v[j+1])/2*math.Exp(-(t.rate(i, j)+spread)*t.dt)
+			if options {
+				if c := cf.call[i]; !math.IsNaN(c) && c < hold {
+					hold = c
+				}
+				if p := cf.put[i]; !math.IsNaN(p) && p > hold {
+					hold = p
+				}
+			}
+			v[j] = hold
+		}
+	}
+	return v[0]
+}
+
+// spreadFor finds the spread over the tree rates at which the bond is worth price.
+func (t *shortRateTree) spreadFor(cf treeCashflow, price float64, options bool) (float64, error) {
+	f := func(s float64) float64 { return t.value(cf, s, options) - price }
+	lo, hi := -0.5, 1.0
+	for f(hi) > 0 && hi < 100 {
+		hi *= 2
+	}
+	if f(lo) < 0 || f(hi) > 0 {
+		return 0, errors.New("no spread reprices the bond at that price")
+	}
+	for k := 0; k < treeSolveIter && hi-lo > treeSolveTol; k++ {
+		mid := (lo + hi) / 2
+		if f(mid) > 0 {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2, nil
+}
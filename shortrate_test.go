@@ -0,0 +1,127 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseZeroCurve(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    map[float64]float64 // rate by tenor, interpolated between the points and flat outside
+		wantErr bool
+	}{
+		{"1:0.30, 0.5:0.20", map[float64]float64{0.25: 0.20, 0.5: 0.20, 0.75: 0.25, 1: 0.30, 10: 0.30}, false},
+		{"2:0.05", map[float64]float64{0.1: 0.05, 5: 0.05}, false},
+		{"", nil, true},
+		{"1=0.3", nil, true},
+		{"0:0.3", nil, true},
+		{"1:-1", nil, true},
+		{"1:0.3,1:0.4", nil, true},
+	}
+	for _, tt := range tests {
+		z, err := parseZeroCurve(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseZeroCurve(%q): error %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		for tenor, want := range tt.want {
+			if got := z.rate(tenor); math.Abs(got-want) > 1e-12 {
+				t.Errorf("parseZeroCurve(%q).rate(%v) = %v, want %v", tt.in, tenor, got, want)
+			}
+		}
+	}
+}
+
+// Each calibrated tree prices the zero coupon bond of every step at the discount factor of the curve.
+func TestShortRateTreeCalibration(t *testing.T) {
+	tests := []struct {
+		name    string
+		model   string
+		curve   string
+		sigma   float64
+		horizon float64
+		steps   int
+	}{
+		{"Ho-Lee flat", ModelHoLee, "1:0.05", 0.01, 5, 60},
+		{"Ho-Lee upward", ModelHoLee, "0.25:0.30,1:0.35,5:0.40", 0.02, 5, 100},
+		{"Ho-Lee without volatility", ModelHoLee, "0.5:0.02,3:0.06", 0, 3, 36},
+		{"BDT flat", ModelBDT, "1:0.05", 0.2, 5, 60},
+		{"BDT inverted", ModelBDT, "0.5:0.60,2:0.45,10:0.30", 0.3, 10, 120},
+		{"BDT one step", ModelBDT, "1:0.10", 0.2, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			curve, err := parseZeroCurve(tt.curve)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tree, err := newShortRateTree(tt.model, curve, tt.sigma, tt.horizon, tt.steps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k := 0; k <= tt.steps; k++ {
+				zero := newTreeCashflow(tt.steps)
+				zero.pay[k] = 1
+				want := curve.discount(float64(k) * tt.horizon / float64(tt.steps))
+				if got := tree.value(zero, 0, false); math.Abs(got-want) > 1e-9 {
+					t.Fatalf("zero coupon of step %d: %v, want %v", k, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestShortRateTreeErrors(t *testing.T) {
+	flat, _ := parseZeroCurve("1:0.05")
+	negative, _ := parseZeroCurve("1:-0.05")
+	tests := []struct {
+		name    string
+		model   string
+		curve   *zeroCurve
+		horizon float64
+		steps   int
+	}{
+		{"no steps", ModelHoLee, flat, 1, 0},
+		{"no horizon", ModelHoLee, flat, 0, 10},
+		{"unknown model", "vasicek", flat, 1, 10},
+		{"BDT with negative rates", ModelBDT, negative, 1, 10},
+	}
+	for _, tt := range tests {
+		if _, err := newShortRateTree(tt.model, tt.curve, 0.2, tt.horizon, tt.steps); err == nil {
+			t.Errorf("%s: want an error", tt.name)
+		}
+	}
+}
+
+// The spread found reprices the cashflow at the price asked, and a higher price needs a lower spread.
+func TestSpreadFor(t *testing.T) {
+	curve, _ := parseZeroCurve("0.5:0.04,5:0.06")
+	tree, err := newShortRateTree(ModelHoLee, curve, 0.01, 5, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf := newTreeCashflow(60)
+	for i := 12; i <= 60; i += 12 {
+		cf.pay[i] = 8
+	}
+	cf.pay[60] += 100
+
+	prev := math.Inf(1)
+	for _, price := range []float64{90, 100, 110} {
+		s, err := tree.spreadFor(cf, price, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := tree.value(cf, s, false); math.Abs(got-price) > 1e-6 {
+			t.Errorf("price %v: the spread %v reprices at %v", price, s, got)
+		}
+		if s >= prev {
+			t.Errorf("price %v: spread %v is not below %v", price, s, prev)
+		}
+		prev = s
+	}
+	if _, err := tree.spreadFor(cf, 1e6, false); err == nil {
+		t.Error("want an error for a price no spread reaches")
+	}
+}
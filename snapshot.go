@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of data kept in snapshots besides the indices, which are kept under their own name (CER, UVA).
+const (
+	snapshotHolidays = "holidays"
+)
+
+// errNoSnapshot is returned when there's no snapshot loaded at or before the requested time.
+var errNoSnapshot = errors.New("no snapshot available for that date")
+
+// snapshot is the content of a snapshot file: the data as it was loaded and when.
+type snapshot struct {
+	Kind     string
+	LoadedAt time.Time
+	Source   string
+	Data     json.RawMessage
+}
+
+// snapshotStore keeps a copy of every distinct load of the index series and holidays, keyed by load time,
+// so valuations can be repeated with the data that was known at a given moment.
+// Files are <dir>/<kind>_<load time>.json. A load identical to the previous one is not stored again,
+// and snapshots older than retention are removed, keeping the one that was current at the cutoff.
+type snapshotStore struct {
+	dir       string
+	retention time.Duration // 0 keeps every snapshot
+	mu        sync.Mutex
+	last      map[string][]byte // Data of the last snapshot of each kind
+}
+
+// Store of snapshots of the service, nil if disabled with SNAPSHOT_DIR=off.
+var snapshots *snapshotStore
+
+// Directorio de snapshots si SNAPSHOT_DIR no está definida.
+const defaultSnapshotDir = "./snapshots"
+
+// Días de snapshots que se conservan si SNAPSHOT_RETENTION_DAYS no está definida.
+const defaultSnapshotRetentionDays = 730
+
+func newSnapshotStore() *snapshotStore {
+	dir := os.Getenv("SNAPSHOT_DIR")
+	if strings.EqualFold(dir, "off") {
+		return nil
+	}
+	if dir == "" {
+		dir = defaultSnapshotDir
+	}
+	days := defaultSnapshotRetentionDays
+	if n, err := strconv.Atoi(os.Getenv("SNAPSHOT_RETENTION_DAYS")); err == nil && n >= 0 {
+		days = n
+	}
+	return &snapshotStore{dir: dir, retention: time.Duration(days) * 24 * time.Hour, last: make(map[string][]byte)}
+}
+
+// Save stores data as a new snapshot of kind unless it is equal to the last one.
+func (s *snapshotStore) Save(kind string, source string, data interface{}) error {
+	if s == nil {
+		return nil
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("marshal %s snapshot: %w", kind, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	last, ok := s.last[kind]
+	if !ok {
+		if files, err := s.files(kind); err == nil && len(files) > 0 {
+			if snap, err := readSnapshot(files[len(files)-1]); err == nil {
+				last = snap.Data
+			}
+		}
+	}
+	if last != nil && bytes.Equal(last, raw) {
+		s.last[kind] = last
+		return nil
+	}
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("create snapshot dir: %w", err)
+	}
+	now := time.Now().UTC()
+	out, err := json.Marshal(snapshot{Kind: kind, LoadedAt: now, Source: source, Data: raw})
+	if err != nil {
+		return fmt.Errorf("marshal %s snapshot: %w", kind, err)
+	}
+	path := filepath.Join(s.dir, kind+"_"+now.Format(backupStamp)+".json")
+	if err := writeFileAtomic(path, out, 0644); err != nil {
+		return fmt.Errorf("write %s snapshot: %w", kind, err)
+	}
+	s.last[kind] = raw
+	if err := s.prune(kind, now); err != nil {
+		return fmt.Errorf("prune %s snapshots: %w", kind, err)
+	}
+	return nil
+}
+
+// prune removes the snapshots of kind loaded more than retention before now, except the last of them:
+// it is the data that was current at the cutoff, so an asOf inside the retention still finds it.
+func (s *snapshotStore) prune(kind string, now time.Time) error {
+	if s.retention <= 0 {
+		return nil
+	}
+	files, err := s.files(kind)
+	if err != nil {
+		return err
+	}
+	keepFrom := snapshotFileAsOf(files, kind, now.Add(-s.retention))
+	for _, f := range files {
+		if f >= keepFrom {
+			break
+		}
+		if err := os.Remove(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadAsOf decodes into v the last snapshot of kind loaded at or before asOf and returns its load time.
+func (s *snapshotStore) LoadAsOf(kind string, asOf time.Time, v interface{}) (time.Time, error) {
+	if s == nil {
+		return time.Time{}, errors.New("snapshots are disabled (SNAPSHOT_DIR=off)")
+	}
+	s.mu.Lock()
+	files, err := s.files(kind)
+	s.mu.Unlock()
+	if err != nil {
+		return time.Time{}, err
+	}
+	path := snapshotFileAsOf(files, kind, asOf)
+	if path == "" {
+		return time.Time{}, fmt.Errorf("%s: %w", kind, errNoSnapshot)
+	}
+	snap, err := readSnapshot(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := json.Unmarshal(snap.Data, v); err != nil {
+		return time.Time{}, fmt.Errorf("decode %s snapshot: %w", kind, err)
+	}
+	return snap.LoadedAt, nil
+}
+
+// snapshotFileAsOf returns the last of files, the sorted snapshot files of kind, loaded at or before asOf.
+// It returns "" if there is none.
+func snapshotFileAsOf(files []string, kind string, asOf time.Time) string {
+	// los nombres ordenan cronológicamente, buscamos el último <= asOf
+	stamp := asOf.UTC().Format(backupStamp)
+	i := sort.Search(len(files), func(i int) bool { return snapshotStampOf(files[i], kind) > stamp })
+	if i == 0 {
+		return ""
+	}
+	return files[i-1]
+}
+
+// snapshotFiles are the snapshot files of some kinds, listed once to tell which snapshots many asOf times resolve to.
+type snapshotFiles map[string][]string
+
+// List returns the snapshot files of kinds.
+func (s *snapshotStore) List(kinds ...string) (snapshotFiles, error) {
+	if s == nil {
+		return nil, errors.New("snapshots are disabled (SNAPSHOT_DIR=off)")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := snapshotFiles{}
+	for _, kind := range kinds {
+		files, err := s.files(kind)
+		if err != nil {
+			return nil, err
+		}
+		out[kind] = files
+	}
+	return out, nil
+}
+
+// key identifies the snapshots LoadAsOf would read at asOf: two times with the same key load the same data.
+func (f snapshotFiles) key(asOf time.Time) string {
+	kinds := make([]string, 0, len(f))
+	for kind := range f {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	var b strings.Builder
+	for _, kind := range kinds {
+		b.WriteString(snapshotFileAsOf(f[kind], kind, asOf))
+		b.WriteByte('|')
+	}
+	return b.String()
+}
+
+// files returns the snapshot files of kind sorted by load time.
+func (s *snapshotStore) files(kind string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, kind+"_*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func snapshotStampOf(path string, kind string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), kind+"_"), ".json")
+}
+
+func readSnapshot(path string) (snapshot, error) {
+	var snap snapshot
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return snap, err
+	}
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return snap, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return snap, nil
+}
+
+// parseAsOf accepts a date, meaning the end of that day in UTC, or an RFC3339 timestamp.
+func parseAsOf(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := time.Parse(DateFormat, s)
+	if err != nil {
+		return time.Time{}, errors.New("invalid asOf, use 2006-01-02 or an RFC3339 timestamp")
+	}
+	return d.Add(24*time.Hour - time.Nanosecond), nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSnapshotFixture writes a snapshot of kind loaded at loadedAt into dir, as Save would have.
+func writeSnapshotFixture(t *testing.T, dir string, kind string, loadedAt time.Time, data interface{}) {
+	t.Helper()
+	raw, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := json.Marshal(snapshot{Kind: kind, LoadedAt: loadedAt, Source: "test", Data: raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, kind+"_"+loadedAt.UTC().Format(backupStamp)+".json"), out, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSnapshotSave(t *testing.T) {
+	s := &snapshotStore{dir: t.TempDir(), last: make(map[string][]byte)}
+	for _, data := range [][]int{{1}, {1}, {1, 2}, {1, 2}} {
+		if err := s.Save("CER", "test", data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if files, _ := s.files("CER"); len(files) != 2 {
+		t.Errorf("%d snapshots, want 2: a load equal to the previous one is not stored", len(files))
+	}
+
+	// un store nuevo sobre el mismo directorio compara con el último archivo
+	again := &snapshotStore{dir: s.dir, last: make(map[string][]byte)}
+	if err := again.Save("CER", "test", []int{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := again.files("CER"); len(files) != 2 {
+		t.Errorf("%d snapshots after a restart, want 2", len(files))
+	}
+}
+
+func TestSnapshotRetention(t *testing.T) {
+	now := time.Now().UTC()
+	tests := []struct {
+		name      string
+		retention time.Duration
+		loaded    []time.Duration // ago
+		want      int             // snapshots left after saving a new one
+	}{
+		{"all inside the retention", 30 * 24 * time.Hour, []time.Duration{20 * 24 * time.Hour, 10 * 24 * time.Hour}, 3},
+		{"the last before the cutoff is kept", 30 * 24 * time.Hour, []time.Duration{90 * 24 * time.Hour, 60 * 24 * time.Hour, 40 * 24 * time.Hour, 10 * 24 * time.Hour}, 3},
+		{"zero keeps everything", 0, []time.Duration{900 * 24 * time.Hour, 600 * 24 * time.Hour}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &snapshotStore{dir: t.TempDir(), retention: tt.retention, last: make(map[string][]byte)}
+			for i, ago := range tt.loaded {
+				writeSnapshotFixture(t, s.dir, "CER", now.Add(-ago), []int{i})
+			}
+			writeSnapshotFixture(t, s.dir, "UVA", now.Add(-900*24*time.Hour), []int{0})
+			if err := s.Save("CER", "test", []int{-1}); err != nil {
+				t.Fatal(err)
+			}
+			if files, _ := s.files("CER"); len(files) != tt.want {
+				t.Errorf("%d snapshots, want %d", len(files), tt.want)
+			}
+			if files, _ := s.files("UVA"); len(files) != 1 {
+				t.Error("saving CER pruned the UVA snapshots")
+			}
+			// asOf en el límite de la retención sigue encontrando los datos que valían entonces
+			if tt.retention > 0 && tt.loaded[0] > tt.retention {
+				var got []int
+				if _, err := s.LoadAsOf("CER", now.Add(-tt.retention+time.Hour), &got); err != nil {
+					t.Errorf("asOf inside the retention: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestSnapshotFilesKey(t *testing.T) {
+	dir := t.TempDir()
+	t1 := mustDate("2024-06-10").Add(12 * time.Hour)
+	t2 := mustDate("2024-06-12").Add(12 * time.Hour)
+	writeSnapshotFixture(t, dir, "CER", t1, []int{1})
+	writeSnapshotFixture(t, dir, "CER", t2, []int{2})
+	writeSnapshotFixture(t, dir, snapshotHolidays, t1, []int{})
+	s := &snapshotStore{dir: dir, last: make(map[string][]byte)}
+	files, err := s.List("CER", snapshotHolidays)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		a, b time.Time
+		same bool
+	}{
+		{"between the same loads", t1.Add(time.Hour), t2.Add(-time.Hour), true},
+		{"exactly at a load", t1, t1.Add(time.Hour), true},
+		{"across a load", t1.Add(time.Hour), t2, false},
+		{"before anything", t1.Add(-time.Hour), t1.Add(-48 * time.Hour), true},
+		{"before and after the first load", t1.Add(-time.Hour), t1, false},
+	}
+	for _, tt := range tests {
+		if got := files.key(tt.a) == files.key(tt.b); got != tt.same {
+			t.Errorf("%s: same key %v, want %v", tt.name, got, tt.same)
+		}
+	}
+}
+
+func TestMarketDataAsOf(t *testing.T) {
+	s := useSnapshots(t)
+	t1 := mustDate("2024-06-10").Add(12 * time.Hour)
+	t2 := mustDate("2024-06-12").Add(12 * time.Hour)
+	writeSnapshotFixture(t, s.dir, snapshotHolidays, t1, arHolidays2024)
+	writeSnapshotFixture(t, s.dir, "CER", t1, []CER{{Date: mustDate("2024-06-07"), CER: 100}})
+	writeSnapshotFixture(t, s.dir, "CER", t2, []CER{{Date: mustDate("2024-06-07"), CER: 100}, {Date: mustDate("2024-06-10"), CER: 101}})
+
+	tests := []struct {
+		name    string
+		asOf    time.Time
+		cerLen  int
+		loaded  time.Time
+		wantErr error
+	}{
+		{"first load", t1.Add(time.Hour), 1, t1, nil},
+		{"second load", t2, 2, t2, nil},
+		{"before the holidays", t1.Add(-time.Hour), 0, time.Time{}, errDataUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md, err := marketDataAsOf(tt.asOf)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := md.indices["CER"].Len(); got != tt.cerLen {
+				t.Errorf("CER with %d values, want %d", got, tt.cerLen)
+			}
+			if !md.CERLoadedAt.Equal(tt.loaded) || !md.HolidaysLoadedAt.Equal(t1) {
+				t.Errorf("loaded at CER %s holidays %s", md.CERLoadedAt, md.HolidaysLoadedAt)
+			}
+			if md.UVALoadedAt != nil || md.indices["UVA"] != nil {
+				t.Error("UVA without snapshots should be missing")
+			}
+			if md.current || md.AsOf == nil || !md.AsOf.Equal(tt.asOf) {
+				t.Errorf("AsOf %v current %v", md.AsOf, md.current)
+			}
+			if md.calendars[CalendarAR].IsWorkday(mustDate("2024-06-17")) {
+				t.Error("the holidays of the snapshot are not used")
+			}
+		})
+	}
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IndexSource loads the full series of an index (CER, ...). Observations may come in any order.
+type IndexSource interface {
+	LoadIndex(ctx context.Context) ([]CER, error)
+	Describe() string
+}
+
+// HolidaySource loads the list of holidays of a calendar.
+type HolidaySource interface {
+	LoadHolidays(ctx context.Context) ([]time.Time, error)
+	Describe() string
+}
+
+// Timeout de las descargas por HTTP.
+const sourceHTTPTimeout = 30 * time.Second
+
+// newIndexSource builds the source of an index from the environment:
+// <NAME>_SOURCE = postgres (default) | file | http, <NAME>_PATH for files and <NAME>_URL for http.
+// The postgres source reads the table and column named after the index, e.g. SELECT date, "CER" FROM "CER".
+func newIndexSource(name string) (IndexSource, error) {
+	kind := strings.ToLower(os.Getenv(name + "_SOURCE"))
+	switch kind {
+	case "", "postgres":
+		return &pgIndexSource{table: name, column: name}, nil
+	case "file":
+		path := os.Getenv(name + "_PATH")
+		if path == "" {
+			return nil, fmt.Errorf("%s_SOURCE=file requires %s_PATH", name, name)
+		}
+		return &fileIndexSource{path: path}, nil
+	case "http":
+		url := os.Getenv(name + "_URL")
+		if url == "" {
+			return nil, fmt.Errorf("%s_SOURCE=http requires %s_URL", name, name)
+		}
+		return &httpIndexSource{url: url}, nil
+	default:
+		return nil, fmt.Errorf("unknown %s_SOURCE %q", name, kind)
+	}
+}
+
+// newHolidaySource builds the source of the holidays from HOLIDAYS_SOURCE, HOLIDAYS_PATH and HOLIDAYS_URL.
+func newHolidaySource() (HolidaySource, error) {
+	kind := strings.ToLower(os.Getenv("HOLIDAYS_SOURCE"))
+	switch kind {
+	case "", "postgres":
+		return &pgHolidaySource{}, nil
+	case "file":
+		path := os.Getenv("HOLIDAYS_PATH")
+		if path == "" {
+			return nil, errors.New("HOLIDAYS_SOURCE=file requires HOLIDAYS_PATH")
+		}
+		return &fileHolidaySource{path: path}, nil
+	case "http":
+		url := os.Getenv("HOLIDAYS_URL")
+		if url == "" {
+			return nil, errors.New("HOLIDAYS_SOURCE=http requires HOLIDAYS_URL")
+		}
+		return &httpHolidaySource{url: url}, nil
+	default:
+		return nil, fmt.Errorf("unknown HOLIDAYS_SOURCE %q", kind)
+	}
+}
+
+// pgIndexSource reads an index from a Postgres table with columns date and <column>.
+type pgIndexSource struct {
+	table  string
+	column string
+}
+
+func (s *pgIndexSource) Describe() string {
+	return fmt.Sprintf("postgres %s:%s/%s table %q", os.Getenv("POSTGRES_HOST"), os.Getenv("POSTGRES_PORT"), os.Getenv("POSTGRES_DB"), s.table)
+}
+
+func (s *pgIndexSource) LoadIndex(ctx context.Context) ([]CER, error) {
+	db, err := openPostgres()
+	if err != nil {
+		return nil, fmt.Errorf("open db: %w", err)
+	}
+	defer db.Close()
+
+	// Using escaped quotes for table name
+	query := fmt.Sprintf(`SELECT date, "%s" FROM "%s"`, s.column, s.table)
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("query %s table: %w", s.table, err)
+	}
+	defer rows.Close()
+
+	var series []CER
+	for rows.Next() {
+		var c CER
+		if err := rows.Scan(&c.Date, &c.CER); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		series = append(series, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+	return series, nil
+}
+
+// fileIndexSource reads an index from a local file.
+// .csv: date,value per line (a header line is skipped). .json: see parseIndexJSON.
+type fileIndexSource struct {
+	path string
+}
+
+func (s *fileIndexSource) Describe() string {
+	return "file " + s.path
+}
+
+func (s *fileIndexSource) LoadIndex(ctx context.Context) ([]CER, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(filepath.Ext(s.path), ".csv") {
+		return parseIndexCSV(data)
+	}
+	return parseIndexJSON(data)
+}
+
+// httpIndexSource downloads an index in the format of the BCRA statistics API.
+type httpIndexSource struct {
+	url string
+}
+
+func (s *httpIndexSource) Describe() string {
+	return "http " + s.url
+}
+
+func (s *httpIndexSource) LoadIndex(ctx context.Context) ([]CER, error) {
+	data, err := httpGet(ctx, s.url)
+	if err != nil {
+		return nil, err
+	}
+	return parseIndexJSON(data)
+}
+
+// pgHolidaySource reads the holidays from the "calendarioFeriados" table.
+type pgHolidaySource struct{}
+
+func (s *pgHolidaySource) Describe() string {
+	return fmt.Sprintf("postgres %s:%s/%s table \"calendarioFeriados\"", os.Getenv("POSTGRES_HOST"), os.Getenv("POSTGRES_PORT"), os.Getenv("POSTGRES_DB"))
+}
+
+func (s *pgHolidaySource) LoadHolidays(ctx context.Context) ([]time.Time, error) {
+	db, err := openPostgres()
+	if err != nil {
+		return nil, fmt.Errorf("open db: %w", err)
+	}
+	defer db.Close()
+
+	if err := db.PingContext(ctx); err != nil {
+		return nil, fmt.Errorf("ping db: %w", err)
+	}
+
+	// Ajusta los nombres de columnas si en tu tabla difieren.
+	rows, err := db.QueryContext(ctx, `SELECT date FROM "calendarioFeriados"`)
+	if err != nil {
+		return nil, fmt.Errorf("query feriados: %w", err)
+	}
+	defer rows.Close()
+
+	var dates []time.Time
+	for rows.Next() {
+		var d time.Time
+		if err := rows.Scan(&d); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		dates = append(dates, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+	return dates, nil
+}
+
+// fileHolidaySource reads holidays from a local file.
+// .csv: one date per line in the first column (a header line is skipped). .json: see parseHolidaysJSON.
+type fileHolidaySource struct {
+	path string
+}
+
+func (s *fileHolidaySource) Describe() string {
+	return "file " + s.path
+}
+
+func (s *fileHolidaySource) LoadHolidays(ctx context.Context) ([]time.Time, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(filepath.Ext(s.path), ".csv") {
+		return parseHolidaysCSV(data)
+	}
+	return parseHolidaysJSON(data)
+}
+
+// httpHolidaySource downloads a json list of holidays.
+type httpHolidaySource struct {
+	url string
+}
+
+func (s *httpHolidaySource) Describe() string {
+	return "http " + s.url
+}
+
+func (s *httpHolidaySource) LoadHolidays(ctx context.Context) ([]time.Time, error) {
+	data, err := httpGet(ctx, s.url)
+	if err != nil {
+		return nil, err
+	}
+	return parseHolidaysJSON(data)
+}
+
+func httpGet(ctx context.Context, url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, sourceHTTPTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// parseIndexCSV reads date,value lines. Dates are in DateFormat.
+func parseIndexCSV(data []byte) ([]CER, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	var series []CER
+	for line := 1; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("line %d: expected date,value", line)
+		}
+		d, err := time.Parse(DateFormat, strings.TrimSpace(record[0]))
+		if err != nil {
+			if line == 1 {
+				continue // header
+			}
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		series = append(series, CER{Date: d, CER: v})
+	}
+	return series, nil
+}
+
+// bcraValue is one observation as published by the BCRA statistics API.
+type bcraValue struct {
+	Fecha string  `json:"fecha"`
+	Valor float64 `json:"valor"`
+}
+
+// parseIndexJSON accepts:
+//   - the BCRA statistics API response: {"results": [{"fecha": "2024-01-02", "valor": 1.23}, ...]}
+//     or, as in v3, {"results": [{"detalle": [{"fecha": ..., "valor": ...}]}]}
+//   - a plain list of observations: [{"fecha": ..., "valor": ...}] or [{"Date": ..., "CER": ...}]
+func parseIndexJSON(data []byte) ([]CER, error) {
+	var wrapped struct {
+		Results json.RawMessage `json:"results"`
+	}
+	if err := json.Unmarshal(data, &wrapped); err == nil && len(wrapped.Results) > 0 {
+		var nested []struct {
+			Detalle []bcraValue `json:"detalle"`
+		}
+		if err := json.Unmarshal(wrapped.Results, &nested); err == nil && len(nested) > 0 && len(nested[0].Detalle) > 0 {
+			var values []bcraValue
+			for _, n := range nested {
+				values = append(values, n.Detalle...)
+			}
+			return bcraToSeries(values)
+		}
+		var values []bcraValue
+		if err := json.Unmarshal(wrapped.Results, &values); err != nil {
+			return nil, fmt.Errorf("parse results: %w", err)
+		}
+		return bcraToSeries(values)
+	}
+
+	var plain []struct {
+		Fecha string   `json:"fecha"`
+		Valor *float64 `json:"valor"`
+		Date  string   `json:"Date"`
+		CER   *float64 `json:"CER"`
+	}
+	if err := json.Unmarshal(data, &plain); err != nil {
+		return nil, fmt.Errorf("parse index json: %w", err)
+	}
+	values := make([]bcraValue, 0, len(plain))
+	for i, p := range plain {
+		switch {
+		case p.Fecha != "" && p.Valor != nil:
+			values = append(values, bcraValue{Fecha: p.Fecha, Valor: *p.Valor})
+		case p.Date != "" && p.CER != nil:
+			values = append(values, bcraValue{Fecha: p.Date, Valor: *p.CER})
+		default:
+			return nil, fmt.Errorf("observation %d: missing date or value", i+1)
+		}
+	}
+	return bcraToSeries(values)
+}
+
+func bcraToSeries(values []bcraValue) ([]CER, error) {
+	series := make([]CER, 0, len(values))
+	for _, v := range values {
+		d, err := parseSourceDate(v.Fecha)
+		if err != nil {
+			return nil, err
+		}
+		series = append(series, CER{Date: d, CER: v.Valor})
+	}
+	return series, nil
+}
+
+func parseHolidaysCSV(data []byte) ([]time.Time, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	var dates []time.Time
+	for line := 1; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		d, err := time.Parse(DateFormat, strings.TrimSpace(record[0]))
+		if err != nil {
+			if line == 1 {
+				continue // header
+			}
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		dates = append(dates, d)
+	}
+	return dates, nil
+}
+
+// parseHolidaysJSON accepts a list of dates ["2024-01-01", ...] or of objects with a "fecha" or "date" field,
+// like the ones returned by the public holiday APIs.
+func parseHolidaysJSON(data []byte) ([]time.Time, error) {
+	var plain []string
+	if err := json.Unmarshal(data, &plain); err == nil {
+		dates := make([]time.Time, 0, len(plain))
+		for _, s := range plain {
+			d, err := parseSourceDate(s)
+			if err != nil {
+				return nil, err
+			}
+			dates = append(dates, d)
+		}
+		return dates, nil
+	}
+
+	var objs []struct {
+		Fecha string `json:"fecha"`
+		Date  string `json:"date"`
+	}
+	if err := json.Unmarshal(data, &objs); err != nil {
+		return nil, fmt.Errorf("parse holidays json: %w", err)
+	}
+	dates := make([]time.Time, 0, len(objs))
+	for i, o := range objs {
+		s := o.Fecha
+		if s == "" {
+			s = o.Date
+		}
+		if s == "" {
+			return nil, fmt.Errorf("holiday %d: missing date", i+1)
+		}
+		d, err := parseSourceDate(s)
+		if err != nil {
+			return nil, err
+		}
+		dates = append(dates, d)
+	}
+	return dates, nil
+}
+
+// Las fuentes publican fechas como "2006-01-02", con hora ("2006-01-02T00:00:00") o como "02/01/2006".
+func parseSourceDate(s string) (time.Time, error) {
+	if len(s) >= len(DateFormat) {
+		if d, err := time.Parse(DateFormat, s[:len(DateFormat)]); err == nil {
+			return d, nil
+		}
+	}
+	if d, err := time.Parse("02/01/2006", s); err == nil {
+		return d, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
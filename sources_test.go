@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func mustDate(s string) time.Time {
+	d, err := time.Parse(DateFormat, s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+var fixtureSeries = []CER{
+	{Date: mustDate("2024-01-02"), CER: 100.5},
+	{Date: mustDate("2024-01-03"), CER: 100.75},
+	{Date: mustDate("2024-01-04"), CER: 101},
+}
+
+var fixtureHolidays = []time.Time{mustDate("2024-01-01"), mustDate("2024-02-12"), mustDate("2024-02-13")}
+
+func TestFileIndexSource(t *testing.T) {
+	tests := []struct {
+		file    string
+		wantErr bool
+	}{
+		{"cer.csv", false},
+		{"cer_bcra.json", false},
+		{"cer_bcra_v3.json", false},
+		{"cer_plain.json", false},
+		{"cer_bad.csv", true},
+		{"missing.csv", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			s := &fileIndexSource{path: filepath.Join("testdata", tt.file)}
+			series, err := s.LoadIndex(context.Background())
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkSeries(t, series)
+		})
+	}
+}
+
+func TestHTTPIndexSource(t *testing.T) {
+	tests := []struct {
+		file    string
+		status  int
+		wantErr bool
+	}{
+		{"cer_bcra.json", http.StatusOK, false},
+		{"cer_bcra_v3.json", http.StatusOK, false},
+		{"cer_bcra.json", http.StatusInternalServerError, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			data, err := ioutil.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write(data)
+			}))
+			defer srv.Close()
+
+			series, err := (&httpIndexSource{url: srv.URL}).LoadIndex(context.Background())
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkSeries(t, series)
+		})
+	}
+}
+
+func checkSeries(t *testing.T, series []CER) {
+	t.Helper()
+	sort.Slice(series, func(i, j int) bool { return series[i].Date.Before(series[j].Date) })
+	if len(series) != len(fixtureSeries) {
+		t.Fatalf("got %d observations, want %d", len(series), len(fixtureSeries))
+	}
+	for i, want := range fixtureSeries {
+		if !series[i].Date.Equal(want.Date) || series[i].CER != want.CER {
+			t.Errorf("observation %d: got %v %v, want %v %v", i, series[i].Date.Format(DateFormat), series[i].CER, want.Date.Format(DateFormat), want.CER)
+		}
+	}
+}
+
+func TestFileHolidaySource(t *testing.T) {
+	tests := []struct {
+		file    string
+		wantErr bool
+	}{
+		{"holidays.csv", false},
+		{"holidays.json", false},
+		{"holidays_objs.json", false},
+		{"cer_bcra.json", true},
+		{"missing.json", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			s := &fileHolidaySource{path: filepath.Join("testdata", tt.file)}
+			dates, err := s.LoadHolidays(context.Background())
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(dates) != len(fixtureHolidays) {
+				t.Fatalf("got %d holidays, want %d", len(dates), len(fixtureHolidays))
+			}
+			for i, want := range fixtureHolidays {
+				if !dates[i].Equal(want) {
+					t.Errorf("holiday %d: got %s, want %s", i, dates[i].Format(DateFormat), want.Format(DateFormat))
+				}
+			}
+		})
+	}
+}
+
+func TestNewIndexSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    string // Describe of the source
+		wantErr bool
+	}{
+		{"file", map[string]string{"TESTIDX_SOURCE": "file", "TESTIDX_PATH": "testdata/cer.csv"}, "file testdata/cer.csv", false},
+		{"file without path", map[string]string{"TESTIDX_SOURCE": "file"}, "", true},
+		{"http", map[string]string{"TESTIDX_SOURCE": "HTTP", "TESTIDX_URL": "http://localhost/cer"}, "http http://localhost/cer", false},
+		{"http without url", map[string]string{"TESTIDX_SOURCE": "http"}, "", true},
+		{"unknown", map[string]string{"TESTIDX_SOURCE": "ftp"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, k := range []string{"TESTIDX_SOURCE", "TESTIDX_PATH", "TESTIDX_URL"} {
+				t.Setenv(k, tt.env[k])
+			}
+			s, err := newIndexSource("TESTIDX")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.Describe(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Sides of a trade.
+const (
+	SideBuy  = "buy"
+	SideSell = "sell"
+)
+
+// IVA por defecto sobre comisiones y derechos de mercado.
+const defaultTicketVAT = 0.21
+
+// feeSchedule are the costs of a trade as fractions of the gross amount (clean consideration plus accrued interest).
+// VAT is charged on the broker fee and the market rights.
+type feeSchedule struct {
+	BrokerFee float64
+	MarketFee float64
+	VAT       float64
+}
+
+// defaultFeeSchedule reads the costs from TICKET_BROKER_FEE, TICKET_MARKET_FEE and TICKET_VAT (0, 0 and 21% if not set).
+func defaultFeeSchedule() feeSchedule {
+	fees := feeSchedule{VAT: defaultTicketVAT}
+	read := func(name string, v *float64) {
+		if f, err := strconv.ParseFloat(os.Getenv(name), 64); err == nil && f >= 0 {
+			*v = f
+		}
+	}
+	read("TICKET_BROKER_FEE", &fees.BrokerFee)
+	read("TICKET_MARKET_FEE", &fees.MarketFee)
+	read("TICKET_VAT", &fees.VAT)
+	return fees
+}
+
+// feeScheduleFromQuery overrides the default costs with the brokerFee, marketFee and vat params.
+func feeScheduleFromQuery(c *gin.Context) (feeSchedule, error) {
+	fees := defaultFeeSchedule()
+	for param, v := range map[string]*float64{"brokerFee": &fees.BrokerFee, "marketFee": &fees.MarketFee, "vat": &fees.VAT} {
+		s := c.Query(param)
+		if s == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || f < 0 || f >= 1 {
+			return fees, fmt.Errorf("%s should be a fraction between 0 and 1, e.g. 0.005 for 0.5%%", param)
+		}
+		*v = f
+	}
+	return fees, nil
+}
+
+// ticketAmounts is the settlement of a trade, in settlement currency and rounded to cents.
+// Total is what the buyer pays or the seller receives.
+type ticketAmounts struct {
+	CleanConsideration float64
+	AccruedInterest    float64
+	GrossAmount        float64
+	BrokerFee          float64
+	MarketFee          float64
+	VAT                float64
+	TotalCosts         float64
+	Total              float64
+}
+
+func roundCents(x float64) float64 {
+	return math.Round(x*100) / 100
+}
+
+// computeTicket settles nominal face value at a clean price and accrued interest per 100 of original face value
+// (both index adjusted), converted to settlement currency with fx. Every line is rounded so the ticket adds up.
+func computeTicket(nominal float64, cleanPrice float64, accInt float64, fx float64, side string, fees feeSchedule) ticketAmounts {
+	var t ticketAmounts
+	t.CleanConsideration = roundCents(nominal / 100 * cleanPrice * fx)
+	t.AccruedInterest = roundCents(nominal / 100 * accInt * fx)
+	t.GrossAmount = roundCents(t.CleanConsideration + t.AccruedInterest)
+	t.BrokerFee = roundCents(t.GrossAmount * fees.BrokerFee)
+	t.MarketFee = roundCents(t.GrossAmount * fees.MarketFee)
+	t.VAT = roundCents((t.BrokerFee + t.MarketFee) * fees.VAT)
+	t.TotalCosts = roundCents(t.BrokerFee + t.MarketFee + t.VAT)
+	t.Total = roundCents(t.GrossAmount + t.TotalCosts)
+	if side == SideSell {
+		t.Total = roundCents(t.GrossAmount - t.TotalCosts)
+	}
+	return t
+}
+
+// ticketWrapper computes the settlement amount of a trade of nominal face value of ticker at price (in priceType and quote,
+// as /yield). The breakdown shows the clean consideration, the accrued interest adjusted by the index ratio, the fees and the
+// VAT on them, in settlement currency (fx units of it per unit of the bond's currency, 1 by default).
+func ticketWrapper(c *gin.Context) {
+	ticker := strings.ToUpper(c.Query("ticker"))
+	nominal, err := strconv.ParseFloat(c.Query("nominal"), 64)
+	if err != nil || nominal <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nominal should be a number greater than 0"})
+		return
+	}
+	price, err := strconv.ParseFloat(c.Query("price"), 64)
+	if err != nil || price <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "price should be a number greater than 0"})
+		return
+	}
+	side := strings.ToLower(c.DefaultQuery("side", SideBuy))
+	if side != SideBuy && side != SideSell {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "side should be buy or sell"})
+		return
+	}
+	fx := 1.0
+	if s := c.Query("fx"); s != "" {
+		if fx, err = strconv.ParseFloat(s, 64); err != nil || fx <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "fx should be a number greater than 0"})
+			return
+		}
+	}
+	extendIndex := 0.0
+	if s := c.Query("extendIndex"); s != "" {
+		if extendIndex, err = strconv.ParseFloat(s, 64); err != nil || extendIndex < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "extendIndex should be a number greater or equal to 0"})
+			return
+		}
+	}
+	fees, err := feeScheduleFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	quote, err := normalizeQuote(c.Query("quote"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	bonds, err := bondsForRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	_, index, err := getCashFlow(bonds, ticker)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "ticker not found"})
+		return
+	}
+	b := bonds[index]
+	if b.isDual() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "dual bonds are not supported"})
+		return
+	}
+	priceType, err := priceTypeFor(b, c.Query("priceType"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	md, err := marketDataForRequest(c)
+	if err != nil {
+		c.JSON(indexErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	settlementDate, err := settlementDateFromQuery(c, ticker, bonds, md)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	flow, err := md.cashflow(b)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	adj, err := md.indexRatio(b, settlementDate, extendIndex)
+	if err != nil {
+		c.JSON(indexErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	face, entitled, err := md.entitlement(b, flow, settlementDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// todo a valor nominal original y precio sucio, como /yield
+	orig := toOriginalFace(price, quote, face)
+	info := extendedInfo(face, &orig, adj.ratio)
+	dirty := toDirty(orig, priceType, info.accInt)
+	info = extendedInfo(face, &dirty, adj.ratio)
+	t := computeTicket(nominal, dirty-info.accInt, info.accInt, fx, side, fees)
+
+	out := gin.H{
+		"Ticker":         ticker,
+		"SettlementDate": Fecha(settlementDate),
+		"Side":           side,
+		"Nominal":        nominal,
+		"Price":          price,
+		"PriceType":      priceType,
+		"Quote":          quote,
+		"CleanPrice":     fromOriginalFace(dirty-info.accInt, quote, face),
+		"DirtyPrice":     fromOriginalFace(dirty, quote, face),
+		"Fx":             fx,
+		"Fees":           fees,
+		"Ticket":         t,
+		"PoolFactor":     info.factor,
+		"Ratio":          adj.ratio,
+		"Extrapolated":   adj.extrapolated,
+		"MarketData":     md,
+	}
+	// the buyer's yield counting the costs as an initial fee
+	if side == SideBuy && t.GrossAmount > 0 {
+		if y, err, _ := Yield(entitled, dirty/adj.ratio, settlementDate, t.TotalCosts/t.GrossAmount, 0); err == nil {
+			out["YieldNetOfCosts"] = y
+		}
+	}
+	c.JSON(http.StatusOK, out)
+}
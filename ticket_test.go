@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestComputeTicket(t *testing.T) {
+	fees := feeSchedule{BrokerFee: 0.005, MarketFee: 0.0001, VAT: 0.21}
+	tests := []struct {
+		name       string
+		nominal    float64
+		cleanPrice float64
+		accInt     float64
+		fx         float64
+		side       string
+		fees       feeSchedule
+		want       ticketAmounts
+	}{
+		{
+			name: "buy without fees", nominal: 1000, cleanPrice: 98.5, accInt: 1.25, fx: 1, side: SideBuy,
+			want: ticketAmounts{CleanConsideration: 985, AccruedInterest: 12.5, GrossAmount: 997.5, Total: 997.5},
+		},
+		{
+			// 123.45 * 98.765 = 12192.53925 y 123.45 * 0.0123 = 1.518435
+			name: "lines are rounded to cents", nominal: 12345, cleanPrice: 98.765, accInt: 0.0123, fx: 1, side: SideBuy, fees: fees,
+			want: ticketAmounts{CleanConsideration: 12192.54, AccruedInterest: 1.52, GrossAmount: 12194.06, BrokerFee: 60.97, MarketFee: 1.22, VAT: 13.06, TotalCosts: 75.25, Total: 12269.31},
+		},
+		{
+			name: "sell deducts the costs", nominal: 12345, cleanPrice: 98.765, accInt: 0.0123, fx: 1, side: SideSell, fees: fees,
+			want: ticketAmounts{CleanConsideration: 12192.54, AccruedInterest: 1.52, GrossAmount: 12194.06, BrokerFee: 60.97, MarketFee: 1.22, VAT: 13.06, TotalCosts: 75.25, Total: 12118.81},
+		},
+		{
+			name: "converted with fx", nominal: 100, cleanPrice: 60, accInt: 0.5, fx: 1000.5, side: SideBuy,
+			want: ticketAmounts{CleanConsideration: 60030, AccruedInterest: 500.25, GrossAmount: 60530.25, Total: 60530.25},
+		},
+		{
+			name: "negative accrued interest in the ex-coupon period", nominal: 1000, cleanPrice: 98.5, accInt: -0.333, fx: 1, side: SideBuy,
+			want: ticketAmounts{CleanConsideration: 985, AccruedInterest: -3.33, GrossAmount: 981.67, Total: 981.67},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := computeTicket(tt.nominal, tt.cleanPrice, tt.accInt, tt.fx, tt.side, tt.fees)
+			if got != tt.want {
+				t.Errorf("got  %+v\nwant %+v", got, tt.want)
+			}
+			// las líneas redondeadas suman exactamente el total
+			total := got.GrossAmount + got.TotalCosts
+			if tt.side == SideSell {
+				total = got.GrossAmount - got.TotalCosts
+			}
+			if roundCents(total) != got.Total || roundCents(got.CleanConsideration+got.AccruedInterest) != got.GrossAmount {
+				t.Errorf("the ticket does not add up: %+v", got)
+			}
+		})
+	}
+}
+
+func TestRoundCents(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want float64
+	}{
+		{0.125, 0.13}, // exacto en binario: medio centavo redondea hacia afuera
+		{-0.125, -0.13},
+		{1.004, 1},
+		{60.9703, 60.97},
+	}
+	for _, tt := range tests {
+		if got := roundCents(tt.in); got != tt.want {
+			t.Errorf("roundCents(%v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
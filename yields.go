@@ -17,7 +17,6 @@ import (
 	"encoding/csv"
 
 	"github.com/gin-gonic/gin"
-	"github.com/jasonlvhit/gocron"
 )
 
 // to embed the time in a custom format to parse the dates that come from the json
@@ -37,6 +36,7 @@ type extInfo struct {
 	parity     float64
 	lastCoupon Fecha
 	lastAmort  float64
+	factor     float64
 }
 
 // define data structure to hold the json data
@@ -49,14 +49,23 @@ type Flujo struct {
 }
 
 type Bond struct {
-	ID        string
-	Ticker    string
-	IssueDate Fecha
-	Maturity  Fecha
-	Coupon    float64
-	Cashflow  []Flujo
-	Index     string
-	Offset    int // Indexed bonds uses offset as date lookback period for the Index. In CER adjusted bonds this is set to 10 working days.
+	ID         string
+	Ticker     string
+	IssueDate  Fecha
+	Maturity   Fecha
+	Coupon     float64
+	Cashflow   []Flujo
+	Index      string
+	Offset     int          // Indexed bonds uses offset as date lookback period for the Index. In CER adjusted bonds this is set to 10 working days.
+	Calendar   string       `json:",omitempty"` // business calendar of the payments: AR (default), NY or AR+NY
+	Roll       string       `json:",omitempty"` // roll convention of the payment dates: Unadjusted (default), Following, ModifiedFollowing or Preceding
+	Legs       []BondLeg    `json:",omitempty"` // dual bonds: pays the greater of both legs at each payment date
+	Calls      []Redemption `json:",omitempty"` // dates the issuer can redeem the bond early, see callable.go
+	Puts       []Redemption `json:",omitempty"` // dates the holder can ask for early redemption
+	RecordDays int          `json:",omitempty"` // business days before each payment of its record date; buyers settling after it trade ex-coupon
+	PriceType  string       `json:",omitempty"` // how the market quotes it: dirty (default) or clean, see pricetype.go
+	Currency   string       `json:",omitempty"` // currency of the payments, USD or ARS (dollar-linked bonds pay ARS). Required, used to aggregate portfolios
+	Issuer     string       `json:",omitempty"` // sovereign, provincial or corporate. Required, used by the spread shocks of the scenarios
 }
 
 // embed methods in the custom struct to be able to use them
@@ -94,11 +103,19 @@ func (d Fecha) Format(s string) string {
 	return time.Time(d).Format(s)
 }
 
-func executeCronJob() {
-	gocron.Every(24).Hours().Do(func() {
-		LoadCERWithRetry(context.Background(), time.Minute)
-	})
-	<-gocron.Start()
+// setUpScheduler registers the data refresh jobs and starts them.
+func setUpScheduler() {
+	jobs = newScheduler(schedulerLocation(), schedulerJitter())
+	if err := jobs.Add("cer", defaultCERSchedule, refreshIndex("CER")); err != nil {
+		fmt.Println("Error en el schedule del CER:", err)
+	}
+	if err := jobs.Add("uva", defaultUVASchedule, refreshIndex("UVA")); err != nil {
+		fmt.Println("Error en el schedule de la UVA:", err)
+	}
+	if err := jobs.Add("holidays", defaultHolidaysSchedule, LoadHolidays); err != nil {
+		fmt.Println("Error en el schedule de feriados:", err)
+	}
+	jobs.Start(context.Background())
 }
 
 func main() {
@@ -106,16 +123,25 @@ func main() {
 	fmt.Println("==================================================")
 	fmt.Println("Arrancando servicio yields...", time.Now().Format("2006-01-02 15:04:05"))
 
+	// every load of CER and holidays is kept in SNAPSHOT_DIR so valuations can be repeated asOf a date
+	snapshots = newSnapshotStore()
+
 	// SetUpCalendar creates the calendar and set ups the holidays for Argentina.
 	SetUpCalendar()
-	go executeCronJob() // this will make the cron run in the background.
+	setUpScheduler() // CER, UVA and holidays are refreshed in the background on their cron schedules.
 
 	// load json with all the bond's data and handle any errors
+	// BONDS_STORE=postgres keeps the bonds versioned in Postgres instead of bonds.json
+	bondStore = newBondStore()
 	getBondsData()
+	if fs, ok := bondStore.(*fileBondStore); ok {
+		go watchBondsFile(fs.path, bondsWatchInterval()) // recarga bonds.json cuando se edita a mano
+	}
 
-	// Load the CER data into Coef
-	// Load CER con reintentos cada 1 minuto hasta éxito
-	LoadCERWithRetry(context.Background(), time.Minute)
+	// Load the CER and UVA series
+	// Carga cada índice en uso con reintentos cada 1 minuto hasta éxito, en background para no bloquear el arranque:
+	// mientras no esté cargado los bonos ajustados por ese índice responden 503 y /readyz lo informa.
+	startIndexLoads(time.Minute)
 	//getCER()
 
 	// start of the router and endpoints
@@ -160,9 +186,45 @@ func main() {
 	router.GET("/yield", yieldWrapper)
 	router.GET("/apr", aprWrapper)
 	router.GET("/price", priceWrapper)
+	router.GET("/oas", oasWrapper)
+	router.GET("/ticket", ticketWrapper)
 	router.GET("/schedule", scheduleWrapper)
+	router.GET("/portfolios", listPortfoliosWrapper)
+	router.GET("/portfolios/:name", getPortfolioWrapper)
+	router.PUT("/portfolios/:name", savePortfolioWrapper)
+	router.DELETE("/portfolios/:name", deletePortfolioWrapper)
+	router.GET("/portfolios/:name/value", portfolioValueWrapper)
+	router.POST("/portfolios/value", adhocPortfolioValueWrapper)
+	router.POST("/portfolios/ladder", adhocLadderWrapper)
+	router.GET("/portfolios/:name/ladder", portfolioLadderWrapper)
+	router.POST("/portfolios/scenarios", adhocScenariosWrapper)
+	router.GET("/portfolios/:name/scenarios", portfolioScenariosWrapper)
+	router.GET("/scenarios", listScenariosWrapper)
+	router.GET("/scenarios/run", bondScenariosWrapper)
+	router.GET("/scenarios/:name", getScenarioWrapper)
+	router.PUT("/scenarios/:name", saveScenarioWrapper)
+	router.DELETE("/scenarios/:name", deleteScenarioWrapper)
+	router.GET("/montecarlo", simulateWrapper)
+	router.GET("/prices", listPricesWrapper)
+	router.POST("/prices/import", importPricesWrapper)
+	router.GET("/prices/:ticker", getPricesWrapper)
+	router.DELETE("/prices/:ticker", deletePricesWrapper)
+	router.GET("/prices/:ticker/yields", yieldHistoryWrapper)
 	router.POST("/upload", uploadWrapper)
 	router.GET("/bonds", getBondsWrapper)
+	router.GET("/bonds/:ticker/history", bondHistoryWrapper)
+	router.POST("/admin/reload", reloadWrapper)
+	router.GET("/healthz", healthzWrapper)
+	router.GET("/readyz", readyzWrapper)
+	router.GET("/calendar/settlement", settlementWrapper)
+	router.GET("/calendar/holidays", holidaysWrapper)
+	router.GET("/calendar/isbusinessday", isBusinessDayWrapper)
+	router.GET("/calendar/addbusinessdays", addBusinessDaysWrapper)
+	router.GET("/calendar/businessdays", businessDaysWrapper)
+	router.GET("/index/:name", indexHistoryWrapper)
+	router.GET("/index/:name/lookup", indexLookupWrapper)
+	router.GET("/admin/jobs", jobsWrapper)
+	router.POST("/admin/jobs/:name/run", runJobWrapper)
 	// run the router
 	router.Run("localhost:8080")
 }
@@ -172,12 +234,6 @@ func aprWrapper(c *gin.Context) {
 	// extendIndex: rate at which extend Index (CER). In yearly basis.
 	ticker := strings.ToUpper(c.Query("ticker"))
 
-	settle, _ := c.GetQuery("settlementDate")
-	settlementDate, error := time.Parse("2006-01-02", settle)
-	if error != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"Error in Settlement Date. ": "Invalid date format"})
-		return
-	}
 	priceTemp, _ := c.GetQuery("price")
 	price, error := strconv.ParseFloat(priceTemp, 64)
 	if error != nil {
@@ -217,11 +273,19 @@ func aprWrapper(c *gin.Context) {
 
 	// Get the cashflow only if the ticker is a valid zero coupon bond
 
-	cashFlow, index, error := getCashFlow(ticker)
+	bonds, err := bondsForRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"Error in Bond Version. ": err.Error()})
+		return
+	}
+	_, index, error := getCashFlow(bonds, ticker)
 	if error != nil {
 		c.JSON(http.StatusNotFound, gin.H{"Error: ": "Ticker not found"})
 		return
-	} else if Bonds[index].Coupon != 0 {
+	} else if bonds[index].isDual() {
+		c.JSON(http.StatusBadRequest, gin.H{"Error in Bond. ": "Dual bonds pay the greater of two legs. Try with endpoint /price"})
+		return
+	} else if bonds[index].Coupon != 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"Error in Coupon. ": "The coupon of this bond is not zero. Try with endopoint /yield"})
 		return
 	}
@@ -229,43 +293,34 @@ func aprWrapper(c *gin.Context) {
 	// adjust price, if the bond is indexed, by using the ratio calculated by dividing the index of settlementDate by the index of IssueDate.
 	// There's an offset variable to adjust the lookback period for the index.
 
-	ratio := 1.0
-	var coef1 float64
-	var coef2 float64
-	var coefFecha time.Time
-
-	if Bonds[index].Index != "" { // assuming for now that only one type of index is used: CER
-
-		offset := Bonds[index].Offset
-
-		type error interface {
-			Error() string
-		}
-		var err error
-
-		coefFecha = calendar.WorkdaysFrom(settlementDate, offset)
-		coef1, err = getCoefficient(coefFecha, extendIndex, &Coef)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"Error in CER. ": err.Error()})
-			return
-		}
-		issueDate, _ := time.Parse(DateFormat, (Bonds[index].IssueDate.Format(DateFormat)))
-		coef2, err = getCoefficient(calendar.WorkdaysFrom(issueDate, offset), extendIndex, &Coef)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"Error in CER. ": err.Error()})
-			return
-		}
-
-		ratio = coef1 / coef2
-
+	md, err := marketDataForRequest(c)
+	if err != nil {
+		c.JSON(indexErrorStatus(err), gin.H{"Error in As Of. ": err.Error()})
+		return
 	}
+	settlementDate, err := settlementDateFromQuery(c, ticker, bonds, md)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"Error in Settlement Date. ": err.Error()})
+		return
+	}
+	cashFlow, err := md.cashflow(bonds[index])
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"Error in Calendar. ": err.Error()})
+		return
+	}
+	adj, err := md.indexRatio(bonds[index], settlementDate, extendIndex)
+	if err != nil {
+		c.JSON(indexErrorStatus(err), gin.H{"Error in CER. ": err.Error()})
+		return
+	}
+	ratio, coef1, coef2, coefFecha := adj.ratio, adj.coefUsed, adj.coefIssue, adj.coefDate
 
 	days := time.Time(cashFlow[0].Date).Sub(settlementDate).Hours() / 24
 	r := ((100*(1-endingFee))/((price*(1+initialFee))/ratio) - 1) * (365 / days)
 	mduration := (days / 365) / (1 + r)
 	// va desde issueDate porque es zero coupon
-	accDays := time.Time(settlementDate).Sub(time.Time(Bonds[index].IssueDate)).Hours() / 24
-	coupon := Bonds[index].Coupon //I could have used 0 but this is more informative
+	accDays := time.Time(settlementDate).Sub(time.Time(bonds[index].IssueDate)).Hours() / 24
+	coupon := bonds[index].Coupon //I could have used 0 but this is more informative
 	residual := cashFlow[0].Residual + cashFlow[0].Amort
 	accInt := (accDays / 360 * coupon) * 100
 	techValue := ratio*residual + accInt
@@ -284,14 +339,18 @@ func aprWrapper(c *gin.Context) {
 		"Coef Used":             coef1,
 		"Coef Issue":            coef2,
 		"Coef Fecha de Cálculo": Fecha(coefFecha),
-		"Maturity":              Bonds[index].Maturity,
+		"Coef Used Status":      adj.usedStatus,
+		"Coef Issue Status":     adj.issueStatus,
+		"Extrapolated":          adj.extrapolated,
+		"Maturity":              bonds[index].Maturity,
+		"MarketData":            md,
 	})
 
 }
 
 func getBondsWrapper(c *gin.Context) {
 	var bondsOut []string
-	for _, bond := range Bonds {
+	for _, bond := range currentBonds() {
 		bondsOut = append(bondsOut, bond.Ticker)
 	}
 	c.JSON(http.StatusOK, gin.H{
@@ -312,61 +371,136 @@ func uploadWrapper(c *gin.Context) {
 
 	err = json.Unmarshal([]byte(jsonData), &upload)
 	if err != nil {
-		fmt.Println("error:", err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
 	}
-	upload.ID = strings.ToUpper(strconv.Itoa(len(Bonds) + 1))
 	upload.Ticker = strings.ToUpper(upload.Ticker)
-	Bonds = append(Bonds, upload)
+	setBondDefaults(&upload)
+	if err := validateBonds([]Bond{upload}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	// a bond that already exists keeps its ID and is stored as a new version
+	bonds := currentBonds()
+	upload.ID = strconv.Itoa(len(bonds) + 1)
+	if _, index, err := getCashFlow(bonds, upload.Ticker); err == nil {
+		upload.ID = bonds[index].ID
+	}
+
+	// who and why, to keep the audit trail of the bond
+	author := c.GetHeader("X-User")
+	if author == "" {
+		author = c.DefaultQuery("author", "unknown")
+	}
+	reason := c.Query("reason")
+
+	version, err := bondStore.Save(c.Request.Context(), upload, author, reason)
+	if err != nil {
+		fmt.Println("Error when saving bond:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "bond could not be saved: " + err.Error(),
+		})
+		return
+	}
+	bondsMu.Lock()
+	Bonds = upsertBond(Bonds, upload)
+	bondsMu.Unlock()
 
 	c.JSON(http.StatusOK, gin.H{
 		"Result":      "Bond uploaded",
 		"Assigned ID": upload.ID,
+		"Version":     version,
 	})
+}
 
-	jsonOut, err := json.Marshal(Bonds)
-	if err != nil {
-		fmt.Println("Error when marshalling:", err)
+func bondHistoryWrapper(c *gin.Context) {
+	ticker := strings.ToUpper(c.Param("ticker"))
+	history, err := bondStore.History(c.Request.Context(), ticker)
+	if err == errNoVersioning {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
-	// backup the file containing the data first
-	dest := "./bonds_" + time.Now().Format("2006-01-02") + ".json"
-	orig := "./bonds.json"
-	cpFile, err := ioutil.ReadFile(orig)
-	if err != nil {
-		fmt.Print(err)
+	if len(history) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "ticker not found"})
+		return
 	}
-	err = ioutil.WriteFile(dest, cpFile, 0644)
-	if err != nil {
-		fmt.Println("Error when copying:", err)
+	c.JSON(http.StatusOK, gin.H{
+		"ticker":   ticker,
+		"versions": history,
+	})
+}
+
+// bondsForRequest returns the bonds to value the request with.
+// If bondVersion is given, bonds are loaded as they were on that version of the store so valuations can be reproduced.
+func bondsForRequest(c *gin.Context) ([]Bond, error) {
+	v, ok := c.GetQuery("bondVersion")
+	if !ok || v == "" {
+		return currentBonds(), nil
 	}
-	err = ioutil.WriteFile("./bonds.json", jsonOut, 0644)
+	version, err := strconv.Atoi(v)
 	if err != nil {
-		fmt.Println("Error when writing:", err)
+		return nil, fmt.Errorf("invalid bondVersion: %w", err)
 	}
+	return bondStore.LoadAsOf(c.Request.Context(), version)
 }
 
 func scheduleWrapper(c *gin.Context) {
 	ticker := strings.ToUpper(c.Query("ticker"))
-	settlementDate := c.Query("settlementDate")
-	if ticker == "" || settlementDate == "" {
+	if ticker == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "ticker and settlementDate are required",
 		})
 		return
 	}
-	t, err := time.Parse(DateFormat, settlementDate)
+	bonds, err := bondsForRequest(c)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "invalid settlementDate",
+			"error": err.Error(),
 		})
 		return
 	}
-	cashFlow, _, err := getCashFlow(ticker)
+	_, index, err := getCashFlow(bonds, ticker)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "ticker not found",
 		})
 		return
 	}
+	md, err := marketDataForRequest(c)
+	if err != nil {
+		c.JSON(indexErrorStatus(err), gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	t, err := settlementDateFromQuery(c, ticker, bonds, md)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	cashFlow, err := md.cashflow(bonds[index])
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	// payments in their ex-coupon period are not the buyer's
+	if _, cashFlow, err = md.entitlement(bonds[index], cashFlow, t); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
 	scheduleOut := getScheduleOfPayments(&cashFlow, &t)
 
 	csvString := convertToCSV(scheduleOut)
@@ -416,8 +550,10 @@ func getScheduleOfPayments(cashFlow *[]Flujo, settlementDate *time.Time) []Flujo
 	return schedule
 }
 
-func getCashFlow(ticker string) ([]Flujo, int, error) {
-	for i, bond := range Bonds {
+// getCashFlow returns the cashflow of the bond as stored and its position in bonds. The dates are rolled
+// on the bond's calendar by md.cashflow, so a bad Calendar or Roll is not reported as an unknown ticker.
+func getCashFlow(bonds []Bond, ticker string) ([]Flujo, int, error) {
+	for i, bond := range bonds {
 		if bond.Ticker == ticker {
 			return bond.Cashflow, i, nil
 		}
@@ -426,16 +562,9 @@ func getCashFlow(ticker string) ([]Flujo, int, error) {
 }
 
 func yieldWrapper(c *gin.Context) {
-	/* Params: ticker, settlementDate, price, initialFee, endingFee */
+	/* Params: ticker, settlementDate, price, initialFee, endingFee, priceType */
 
 	ticker := strings.ToUpper(c.Query("ticker"))
-	settle, _ := c.GetQuery("settlementDate")
-	settlementDate, error := time.Parse("2006-01-02", settle)
-	if error != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"Error in Settlement Date. ": "Invalid date format"})
-		//c.JSON(http.StatusBadRequest, gin.H{"error": error.Error()})
-		return
-	}
 	priceTemp, _ := c.GetQuery("price")
 	price, error := strconv.ParseFloat(priceTemp, 64)
 	if error != nil {
@@ -471,71 +600,90 @@ func yieldWrapper(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"Extended Index should be greater or equal to 0": "Error"})
 		return
 	}
+	quote, err := normalizeQuote(c.Query("quote"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"Error in Quote. ": err.Error()})
+		return
+	}
 
-	cashFlow, index, error := getCashFlow(ticker)
+	bonds, err := bondsForRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"Error in Bond Version. ": err.Error()})
+		return
+	}
+	_, index, error := getCashFlow(bonds, ticker)
 	if error != nil {
 		c.JSON(http.StatusNotFound, gin.H{"Error: ": "Ticker not found"})
 		return
+	} else if bonds[index].isDual() {
+		c.JSON(http.StatusBadRequest, gin.H{"Error in Bond. ": "Dual bonds pay the greater of two legs. Try with endpoint /price"})
+		return
+	}
+	priceType, err := priceTypeFor(bonds[index], c.Query("priceType"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"Error in Price Type. ": err.Error()})
+		return
 	}
 
 	// adjust price, if the bond is indexed, by using the ratio calculated by dividing the index of settlementDate by the index of IssueDate.
 	// There's an offset variable to adjust the lookback period for the index.
 
-	ratio := 1.0
-	var coef1 float64
-	var coef2 float64
-	var coefFecha time.Time
-	if Bonds[index].Index != "" { // assuming for now that only one type of index is used: CER
-
-		offset := Bonds[index].Offset
-
-		type error interface {
-			Error() string
-		}
-		var err error
-
-		coefFecha = calendar.WorkdaysFrom(settlementDate, offset)
-		coef1, err = getCoefficient(coefFecha, extendIndex, &Coef)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"Error in CER. ": err.Error()})
-			return
-		}
-		issueDate, _ := time.Parse(DateFormat, (Bonds[index].IssueDate.Format(DateFormat)))
-		tmpFecha := calendar.WorkdaysFrom(issueDate, offset)
-		coef2, err = getCoefficient(tmpFecha, extendIndex, &Coef)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"Error in CER. ": err.Error()})
-			return
-		}
-
-		ratio = coef1 / coef2
+	md, err := marketDataForRequest(c)
+	if err != nil {
+		c.JSON(indexErrorStatus(err), gin.H{"Error in As Of. ": err.Error()})
+		return
+	}
+	settlementDate, err := settlementDateFromQuery(c, ticker, bonds, md)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"Error in Settlement Date. ": err.Error()})
+		return
+	}
+	cashFlow, err := md.cashflow(bonds[index])
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"Error in Calendar. ": err.Error()})
+		return
+	}
+	adj, err := md.indexRatio(bonds[index], settlementDate, extendIndex)
+	if err != nil {
+		c.JSON(indexErrorStatus(err), gin.H{"Error in CER. ": err.Error()})
+		return
+	}
+	ratio, coef1, coef2, coefFecha := adj.ratio, adj.coefUsed, adj.coefIssue, adj.coefDate
 
+	// only the payments whose record date is not before settlement are the buyer's
+	face, entitled, err := md.entitlement(bonds[index], cashFlow, settlementDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"Error in Calendar. ": err.Error()})
+		return
 	}
 
-	price = price / ratio
+	// prices quoted per current face value are taken to original face value, as the cashflow,
+	// and clean prices to dirty with the accrued interest since Yield discounts the full amount paid
+	price = toOriginalFace(price, quote, face)
+	info := extendedInfo(face, &price, ratio)
+	dirty := toDirty(price, priceType, info.accInt)
+	info = extendedInfo(face, &dirty, ratio)
+	price = dirty / ratio
 
-	r, error, cfIndex := Yield(cashFlow, price, settlementDate, initialFee, endingFee)
+	r, error, _ := Yield(entitled, price, settlementDate, initialFee, endingFee)
 	if error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "sth went wrong with the Yield calculation."})
 		return
 	}
 
-	mduration, error := Mduration(cashFlow, r, settlementDate, initialFee, endingFee, price)
+	mduration, error := Mduration(entitled, r, settlementDate, initialFee, endingFee, price)
 	if error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "sth went wrong with the Mduration calculation"})
 		return
 	}
 
-	// Use index to calculate accDays, Parity
-	origPrice := price * ratio // back to price to calculate parity correctly
-
-	// need to adapt to the new way of calling extendedInfo with a struct.
-
-	info := extendedInfo(&settlementDate, &cashFlow, &origPrice, cfIndex, ratio)
-	//accDays, coupon, residual, accInt, techValue, parity, lastCoupon, _ := extendedInfo(&settlementDate, &cashFlow, &origPrice, cfIndex)
-
-	c.JSON(http.StatusOK, gin.H{
+	out := gin.H{
 		"Yield":                 r,
+		"CleanPrice":            fromOriginalFace(dirty-info.accInt, quote, face),
+		"DirtyPrice":            fromOriginalFace(dirty, quote, face),
+		"PriceType":             priceType,
+		"PoolFactor":            info.factor,
+		"Quote":                 quote,
 		"MDuration":             mduration,
 		"AccrualDays":           info.accDays,
 		"CurrentCoupon: ":       info.currCoupon,
@@ -548,20 +696,39 @@ func yieldWrapper(c *gin.Context) {
 		"Coef Used":             coef1,
 		"Coef Issue":            coef2,
 		"Coef Fecha de Cálculo": Fecha(coefFecha),
-		"Maturity":              Bonds[index].Maturity,
-	})
+		"Coef Used Status":      adj.usedStatus,
+		"Coef Issue Status":     adj.issueStatus,
+		"Extrapolated":          adj.extrapolated,
+		"Maturity":              bonds[index].Maturity,
+		"MarketData":            md,
+	}
+
+	// Callable / puttable bonds: yield to each call and put date, to worst and to best
+	if bonds[index].isCallable() {
+		rfs, err := md.redemptionFlows(bonds[index], cashFlow, settlementDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error in Calendar. ": err.Error()})
+			return
+		}
+		all, worst, best, err := yieldsToRedemption(rfs, price, settlementDate, initialFee, endingFee)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "sth went wrong with the Yield calculation. " + err.Error()})
+			return
+		}
+		calls, puts := splitRedemptions(all)
+		out["YieldToCall"] = calls
+		out["YieldToPut"] = puts
+		out["YieldToWorst"] = *worst.Yield
+		out["WorstRedemption"] = worst
+		out["YieldToBest"] = *best.Yield
+		out["BestRedemption"] = best
+	}
+	c.JSON(http.StatusOK, out)
 
 }
 
 func priceWrapper(c *gin.Context) {
 	ticker := strings.ToUpper(c.Query("ticker"))
-	settle, _ := c.GetQuery("settlementDate")
-	settlementDate, error := time.Parse("2006-01-02", settle)
-	if error != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
-		//c.JSON(http.StatusBadRequest, gin.H{"error": error.Error()})
-		return
-	}
 	rateTemp, _ := c.GetQuery("rate")
 	rate, error := strconv.ParseFloat(rateTemp, 64)
 	if error != nil {
@@ -597,50 +764,87 @@ func priceWrapper(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"Extended Index should be greater or equal to 0": "Error"})
 		return
 	}
+	quote, err := normalizeQuote(c.Query("quote"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"Error in Quote. ": err.Error()})
+		return
+	}
 
-	cashFlow, index, error := getCashFlow(ticker)
+	bonds, err := bondsForRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"Error in Bond Version. ": err.Error()})
+		return
+	}
+	_, index, error := getCashFlow(bonds, ticker)
 	if error != nil {
 		c.JSON(http.StatusNotFound, gin.H{"message": "ticker not found"})
 		return
 	}
 
-	ratio := 1.0
-	var coef1 float64
-	var coef2 float64
-	var coefFecha time.Time
-	if Bonds[index].Index != "" { // assuming for now that only one type of index is used: CER
-
-		offset := Bonds[index].Offset
-
-		type error interface {
-			Error() string
+	md, err := marketDataForRequest(c)
+	if err != nil {
+		c.JSON(indexErrorStatus(err), gin.H{"Error in As Of. ": err.Error()})
+		return
+	}
+	settlementDate, err := settlementDateFromQuery(c, ticker, bonds, md)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cashFlow, err := md.cashflow(bonds[index])
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"Error in Calendar. ": err.Error()})
+		return
+	}
+	adj, err := md.indexRatio(bonds[index], settlementDate, extendIndex)
+	if err != nil {
+		c.JSON(indexErrorStatus(err), gin.H{"Error in CER. ": err.Error()})
+		return
+	}
+	ratio, coef1, coef2, coefFecha := adj.ratio, adj.coefUsed, adj.coefIssue, adj.coefDate
+	priceType, err := priceTypeFor(bonds[index], c.Query("priceType"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"Error in Price Type. ": err.Error()})
+		return
+	}
+	if bonds[index].isDual() {
+		if priceType == PriceClean {
+			c.JSON(http.StatusBadRequest, gin.H{"Error in Price Type. ": "dual bonds are priced dirty"})
+			return
 		}
-		var err error
+		priceDual(c, bonds[index], md, settlementDate, rate, initialFee, endingFee, extendIndex)
+		return
+	}
+	// only the payments whose record date is not before settlement are the buyer's
+	face, entitled, err := md.entitlement(bonds[index], cashFlow, settlementDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"Error in Calendar. ": err.Error()})
+		return
+	}
+	p, error, _ := Price(entitled, rate, settlementDate, initialFee, endingFee)
+	if error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "sth went wrong with the Price calculation"})
+		return
+	}
 
-		coefFecha = calendar.WorkdaysFrom(settlementDate, offset)
-		coef1, err = getCoefficient(coefFecha, extendIndex, &Coef)
+	// Callable / puttable bonds are priced to worst, the lowest price of all the redemptions
+	priceFlow := entitled
+	var redemptions []redemptionOut
+	var redemption redemptionOut
+	if bonds[index].isCallable() {
+		rfs, err := md.redemptionFlows(bonds[index], cashFlow, settlementDate)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"Error in CER. ": err.Error()})
+			c.JSON(http.StatusBadRequest, gin.H{"Error in Calendar. ": err.Error()})
 			return
 		}
-
-		issueDate, _ := time.Parse(DateFormat, (Bonds[index].IssueDate.Format(DateFormat)))
-		coef2, err = getCoefficient(calendar.WorkdaysFrom(issueDate, offset), extendIndex, &Coef)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"Error in CER. ": err.Error()})
+		if redemptions, redemption, priceFlow, err = priceToRedemption(rfs, rate, settlementDate, initialFee, endingFee); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "sth went wrong with the Price calculation. " + err.Error()})
 			return
 		}
-
-		ratio = coef1 / coef2
-
-	}
-	p, error, cfIndex := Price(cashFlow, rate, settlementDate, initialFee, endingFee)
-	if error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "sth went wrong with the Price calculation"})
-		return
+		p = *redemption.Price
 	}
 
-	mduration, error := Mduration(cashFlow, rate, settlementDate, initialFee, endingFee, p)
+	mduration, error := Mduration(priceFlow, rate, settlementDate, initialFee, endingFee, p)
 	if error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "sth went wrong with the Mduration calculation"})
 		return
@@ -648,14 +852,19 @@ func priceWrapper(c *gin.Context) {
 
 	p = p * ratio
 
-	// Use index to calculate accDays, Parity
-
-	origPrice := p / ratio
-	info := extendedInfo(&settlementDate, &cashFlow, &origPrice, cfIndex, ratio)
-	//accDays, coupon, residual, accInt, techValue, parity, lastCoupon, _ := extendedInfo(&settlementDate, &cashFlow, &p, cfIndex)
-
-	c.JSON(http.StatusOK, gin.H{
-		"Price":                 p,
+	// Use index to calculate accDays, Parity. Parity compares the adjusted dirty price with the adjusted technical value, as /yield
+	info := extendedInfo(face, &p, ratio)
+	quoted := fromDirty(p, priceType, info.accInt)
+
+	out := gin.H{
+		"Price":                 fromOriginalFace(quoted, quote, face),
+		"CleanPrice":            fromOriginalFace(p-info.accInt, quote, face),
+		"DirtyPrice":            fromOriginalFace(p, quote, face),
+		"PriceType":             priceType,
+		"PriceOriginalFace":     quoted,
+		"PriceCurrentFace":      fromOriginalFace(quoted, QuoteCurrentFace, face),
+		"PoolFactor":            info.factor,
+		"Quote":                 quote,
 		"MDuration":             mduration,
 		"AccrualDays":           info.accDays,
 		"CurrentCoupon: ":       info.currCoupon,
@@ -668,31 +877,43 @@ func priceWrapper(c *gin.Context) {
 		"Coef Used":             coef1,
 		"Coef Issue":            coef2,
 		"Coef Fecha de Cálculo": Fecha(coefFecha),
-		"Maturity":              Bonds[index].Maturity,
-	})
+		"Coef Used Status":      adj.usedStatus,
+		"Coef Issue Status":     adj.issueStatus,
+		"Extrapolated":          adj.extrapolated,
+		"Maturity":              bonds[index].Maturity,
+		"MarketData":            md,
+	}
+	if bonds[index].isCallable() {
+		// prices to each redemption, adjusted like Price
+		for i := range redemptions {
+			adjusted := *redemptions[i].Price * ratio
+			redemptions[i].Price = &adjusted
+		}
+		adjusted := *redemption.Price * ratio
+		redemption.Price = &adjusted
+		calls, puts := splitRedemptions(redemptions)
+		out["PriceToMaturity"] = *redemptions[0].Price
+		out["PriceToCall"] = calls
+		out["PriceToPut"] = puts
+		out["Redemption"] = redemption
+	}
+	c.JSON(http.StatusOK, out)
 
 }
 
-func extendedInfo(settlementDate *time.Time, cashflow *[]Flujo, p *float64, cfIndex int, ratio float64) extInfo {
+func extendedInfo(face faceState, p *float64, ratio float64) extInfo {
 	var info extInfo
 
-	//teng que dejar cfIndex = 0 siempre y cuando el bono sea zerocoupon
+	// residual, cupón vigente y días de devengamiento salen del estado del valor nominal a la fecha de liquidación
+	// (ver faceStateAt), así es correcto también después de una amortización, capitalización o en el período ex-cupón
+	info.accDays = face.accDays
+	info.currCoupon = face.rate //because is the coupon on the next cashflow that will be paid.
+	info.residual = face.residual
+	info.factor = face.factor
+	info.lastCoupon = Fecha(face.lastPayment)
+	info.lastAmort = face.lastAmort
 
-	if cfIndex == 0 {
-		info.accDays = 0
-		info.currCoupon = (*cashflow)[cfIndex+0].Rate //because is the coupon on the next cashflow that will be paid.
-		info.residual = 100
-		info.lastCoupon = Fecha(*settlementDate)
-		info.lastAmort = 0
-	} else {
-		info.accDays = int(time.Time(*settlementDate).Sub(time.Time((*cashflow)[cfIndex].Date)).Hours() / 24) // accDays from last coupon
-		info.currCoupon = (*cashflow)[cfIndex+1].Rate                                                         //because is the coupon on the next cashflow that will be paid.
-		info.residual = (*cashflow)[cfIndex-1].Residual
-		info.lastCoupon = (*cashflow)[cfIndex].Date
-		info.lastAmort = (*cashflow)[cfIndex].Amort
-	}
-
-	info.accInt = (float64(info.accDays) / 360 * info.currCoupon) * info.residual * ratio
+	info.accInt = face.accrued() * ratio
 	info.techValue = float64(info.accInt) + info.residual*ratio
 	info.parity = *p / info.techValue * 100
 
@@ -736,6 +957,22 @@ func Mduration(flow []Flujo, rate float64, settlementDate time.Time, initialFee
 	return (-1 * (dur / (1 + rate/float64(datesPerYear)))), nil
 }
 
+// Convexity is the second derivative of the price with respect to rate over the price, discounting
+// each cashflow at (1+rate)^t with t in years of 365 days, as Price.
+func Convexity(flow []Flujo, rate float64, settlementDate time.Time, initialFee float64, endingFee float64, price float64) (float64, error) {
+	values, dates, _ := GenerateArrays(flow, settlementDate, initialFee, endingFee, 0)
+	if price == 0 {
+		return 0, errors.New("price should not be 0")
+	}
+
+	conv := 0.0
+	for i := 1; i < len(values); i++ {
+		t := dates[i].Sub(dates[0]).Hours() / 24.0 / 365.0
+		conv += values[i] * t * (t + 1) / math.Pow(1+rate, t+2)
+	}
+	return conv / price, nil
+}
+
 func DatesPerYear(dateVector []time.Time) int {
 	counts := make(map[int]int)
 
@@ -801,19 +1038,16 @@ func getBondsData() {
 	fmt.Println("Leyendo data de bonos...")
 	fmt.Println()
 
-	data, err := ioutil.ReadFile("./bonds.json")
-	if err != nil {
-		fmt.Print(err)
-	}
-	// json data
-	// unmarshall the loaded JSON
-	err = json.Unmarshal([]byte(data), &Bonds)
-	if err != nil {
+	// misma carga y validación que una recarga: un set inválido no se sirve y /readyz informa los bonos como no listos
+	if _, err := reloadBonds(context.Background()); err != nil {
 		fmt.Println("error:", err)
+		fmt.Println("No se cargaron bonos. Corregir los datos y recargar con POST /admin/reload")
+		fmt.Println()
+		return
 	}
 	fmt.Println()
 	fmt.Println("Llenado de data de bonos exitosa")
-	fmt.Println("Cantidad de bonos cargados: ", len(Bonds))
+	fmt.Println("Cantidad de bonos cargados: ", len(currentBonds()))
 	fmt.Println()
 
 }
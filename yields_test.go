@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cerBond is a CER adjusted bond paying a 2% coupon every six months and the whole face value at maturity.
+var cerBond = Bond{
+	ID: "T1", Ticker: "TXT1", IssueDate: Fecha(mustDate("2024-01-02")), Maturity: Fecha(mustDate("2025-07-01")),
+	Coupon: 0.02, Index: "CER", Offset: 10, Currency: "ARS", Issuer: "sovereign",
+	Cashflow: []Flujo{
+		{Date: Fecha(mustDate("2024-07-01")), Rate: 0.02, Residual: 100, Amount: 1},
+		{Date: Fecha(mustDate("2025-01-02")), Rate: 0.02, Residual: 100, Amount: 1},
+		{Date: Fecha(mustDate("2025-07-01")), Rate: 0.02, Amort: 100, Residual: 0, Amount: 101},
+	},
+}
+
+// dailyCER returns a CER value for every day between from and to, growing at 3% a month.
+func dailyCER(from string, to string) []CER {
+	var out []CER
+	v := 100.0
+	for d := mustDate(from); !d.After(mustDate(to)); d = d.AddDate(0, 0, 1) {
+		out = append(out, CER{Date: d, CER: v})
+		v *= math.Pow(1.03, 1.0/30)
+	}
+	return out
+}
+
+// setTestMarket makes the handlers value with bonds, the CER series and the AR holidays given,
+// and puts back the loaded data when the test ends.
+func setTestMarket(t *testing.T, bonds []Bond, cer []CER, holidays []time.Time) {
+	t.Helper()
+	prevBonds := currentBonds()
+	prevIndices := currentIndices()
+	calendarsMu.RLock()
+	prevCalendars := calendars
+	calendarsMu.RUnlock()
+	depsMu.Lock()
+	prevDeps := deps
+	deps = map[string]*depStatus{}
+	for k, d := range prevDeps {
+		copied := *d
+		deps[k] = &copied
+	}
+	depsMu.Unlock()
+	t.Cleanup(func() {
+		setBonds(prevBonds)
+		indicesMu.Lock()
+		indices = prevIndices
+		indicesMu.Unlock()
+		calendarsMu.Lock()
+		calendars = prevCalendars
+		calendarsMu.Unlock()
+		depsMu.Lock()
+		deps = prevDeps
+		depsMu.Unlock()
+	})
+
+	setBonds(bonds)
+	markDependency(depBonds, len(bonds), nil)
+	if cer != nil {
+		series, err := newIndexSeries("CER", cer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		setIndex(series)
+		markDependency(depCER, series.Len(), nil)
+	}
+	calendarsMu.Lock()
+	calendars = buildCalendars(holidays)
+	calendarsMu.Unlock()
+	markDependency(depHolidays, len(holidays), nil)
+}
+
+// getJSON calls handler with a GET of target and decodes the json it answers.
+func getJSON(t *testing.T, handler gin.HandlerFunc, target string) (int, map[string]interface{}) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, target, nil)
+	handler(c)
+	out := map[string]interface{}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("%s: %v in %s", target, err, w.Body.String())
+	}
+	return w.Code, out
+}
+
+// /price and /yield of the same bond at the same price agree on the parity, for an indexed bond too.
+func TestPriceAndYieldParity(t *testing.T) {
+	straight := cerBond
+	straight.ID, straight.Ticker, straight.Index, straight.Offset = "T2", "TXT2", "", 0
+	setTestMarket(t, []Bond{cerBond, straight}, dailyCER("2023-12-01", "2024-06-30"), nil)
+
+	tests := []struct {
+		ticker     string
+		settlement string
+		rate       float64
+	}{
+		{"TXT1", "2024-05-15", 0.05},
+		{"TXT1", "2024-03-01", -0.02},
+		{"TXT2", "2024-05-15", 0.05},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ticker+" "+tt.settlement, func(t *testing.T) {
+			query := "?ticker=" + tt.ticker + "&settlementDate=" + tt.settlement + "&initialFee=0&endingFee=0"
+			code, price := getJSON(t, priceWrapper, "/price"+query+"&rate="+formatFloat(tt.rate))
+			if code != http.StatusOK {
+				t.Fatalf("/price: %d %v", code, price)
+			}
+			dirty := price["DirtyPrice"].(float64)
+			if want := dirty / price["TechnicalValue"].(float64) * 100; math.Abs(price["Parity"].(float64)-want) > 1e-9 {
+				t.Errorf("/price parity %v, want DirtyPrice / TechnicalValue = %v", price["Parity"], want)
+			}
+
+			code, yield := getJSON(t, yieldWrapper, "/yield"+query+"&price="+formatFloat(dirty))
+			if code != http.StatusOK {
+				t.Fatalf("/yield: %d %v", code, yield)
+			}
+			if math.Abs(yield["Parity"].(float64)-price["Parity"].(float64)) > 1e-9 {
+				t.Errorf("parity: /yield %v, /price %v", yield["Parity"], price["Parity"])
+			}
+			if math.Abs(yield["Yield"].(float64)-tt.rate) > 1e-6 {
+				t.Errorf("/yield at the /price price: %v, want %v", yield["Yield"], tt.rate)
+			}
+		})
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}